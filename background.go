@@ -0,0 +1,64 @@
+package tiler
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/posener/tiler/internal/clrlib"
+	"github.com/posener/tiler/internal/imglib"
+)
+
+// Background is the layer that is drawn before the tiles are placed.
+type Background struct {
+	Kind BackgroundKind
+	// Color is the color of the BackgroundColor background.
+	Color color.Color
+	// Amount is the blur radius in pixels of the BackgroundBlur background, and the dimming factor
+	// in range [0..1] of the BackgroundDim background, where 0 keeps the original image and 1
+	// results in black.
+	Amount float64
+}
+
+// BackgroundKind is a kind of background.
+type BackgroundKind string
+
+// Available background kinds.
+const (
+	// BackgroundTransparent leaves the areas that are not covered by tiles transparent.
+	BackgroundTransparent BackgroundKind = "transparent"
+	// BackgroundColor is a solid color.
+	BackgroundColor BackgroundKind = "color"
+	// BackgroundOriginal is the original image.
+	BackgroundOriginal BackgroundKind = "original"
+	// BackgroundBlur is a blurred copy of the original image.
+	BackgroundBlur BackgroundKind = "blur"
+	// BackgroundDim is a darkened copy of the original image.
+	BackgroundDim BackgroundKind = "dim"
+)
+
+// draw draws the background of the given image on the destination image.
+func (b Background) draw(dst *image.RGBA, img image.Image) error {
+	switch b.Kind {
+	case "", BackgroundTransparent:
+	case BackgroundColor:
+		if b.Color == nil {
+			return fmt.Errorf("color background without color")
+		}
+		draw.Draw(dst, dst.Bounds(), image.NewUniform(b.Color), image.ZP, draw.Src)
+	case BackgroundOriginal:
+		draw.Draw(dst, dst.Bounds(), img, img.Bounds().Min, draw.Src)
+	case BackgroundBlur:
+		draw.Draw(dst, dst.Bounds(), imglib.Blur(img, int(b.Amount)), img.Bounds().Min, draw.Src)
+	case BackgroundDim:
+		if b.Amount < 0 || b.Amount > 1 {
+			return fmt.Errorf("dim amount %f not in range [0..1]", b.Amount)
+		}
+		s := 1 - b.Amount
+		draw.Draw(dst, dst.Bounds(), imglib.WithModel(img, clrlib.Scaled{R: s, G: s, B: s}), img.Bounds().Min, draw.Src)
+	default:
+		return fmt.Errorf("unknown background %q", b.Kind)
+	}
+	return nil
+}
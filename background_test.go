@@ -0,0 +1,42 @@
+package tiler
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackground(t *testing.T) {
+	t.Parallel()
+
+	img := uniform(image.Rect(1, 1, 3, 3), color.RGBA{200, 100, 50, 255})
+
+	tests := []struct {
+		bg      Background
+		want    color.Color
+		wantErr bool
+	}{
+		{bg: Background{}, want: color.RGBA{}},
+		{bg: Background{Kind: BackgroundTransparent}, want: color.RGBA{}},
+		{bg: Background{Kind: BackgroundColor, Color: color.White}, want: color.RGBA{255, 255, 255, 255}},
+		{bg: Background{Kind: BackgroundOriginal}, want: color.RGBA{200, 100, 50, 255}},
+		{bg: Background{Kind: BackgroundBlur, Amount: 2}, want: color.RGBA{200, 100, 50, 255}},
+		{bg: Background{Kind: BackgroundDim, Amount: 0.5}, want: color.RGBA{100, 50, 25, 255}},
+		{bg: Background{Kind: BackgroundColor}, wantErr: true},
+		{bg: Background{Kind: BackgroundDim, Amount: 2}, wantErr: true},
+		{bg: Background{Kind: "foo"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		dst := image.NewRGBA(img.Bounds())
+		err := tt.bg.draw(dst, img)
+		if tt.wantErr {
+			assert.Error(t, err, "%+v", tt.bg)
+			continue
+		}
+		assert.NoError(t, err, "%+v", tt.bg)
+		assert.Equal(t, tt.want, dst.At(2, 2), "%+v", tt.bg)
+	}
+}
@@ -0,0 +1,73 @@
+package tiler
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/posener/tiler/internal/clrlib"
+	"github.com/posener/tiler/internal/imglib"
+)
+
+// Blend defines how to blend the tiles with the original image, to trade tiles fidelity with the
+// original image fidelity.
+type Blend struct {
+	Mode BlendMode
+	// Opacity is the blending amount in range [0..1], where 0 keeps the tiles as they are.
+	Opacity float64
+}
+
+// BlendMode is a mode of blending the tiles with the original image.
+type BlendMode string
+
+// Available blend modes.
+const (
+	// BlendNone does not blend the tiles.
+	BlendNone BlendMode = "none"
+	// BlendOverlay draws a translucent copy of the original image over the tiled image.
+	BlendOverlay BlendMode = "overlay"
+	// BlendColor shifts the colors of each tile towards the most common color of the image box
+	// it is placed on. It is applied to the tiles as they are placed.
+	BlendColor BlendMode = "color"
+	// BlendLuminance shifts the luminance of each tile towards the luminance of the most common
+	// color of the image box it is placed on. It is applied to the tiles as they are placed.
+	BlendLuminance BlendMode = "luminance"
+)
+
+func (b Blend) validate() error {
+	switch b.Mode {
+	case "", BlendNone, BlendOverlay, BlendColor, BlendLuminance:
+	default:
+		return fmt.Errorf("unknown blend mode %q", b.Mode)
+	}
+	if b.Opacity < 0 || b.Opacity > 1 {
+		return fmt.Errorf("blend opacity %f not in range [0..1]", b.Opacity)
+	}
+	return nil
+}
+
+// tile returns the image of a matched tile, blended with the box of the image it is placed on.
+func (b Blend) tile(m match) image.Image {
+	if b.Opacity == 0 || m.box.Color == nil {
+		return m.tile.Image
+	}
+	switch b.Mode {
+	case BlendColor:
+		return imglib.WithModel(m.tile.Image, clrlib.NewShift(m.tile.Color, m.box.Color, b.Opacity))
+	case BlendLuminance:
+		d := b.Opacity * (clrlib.Luminance(m.box.Color) - clrlib.Luminance(m.tile.Color))
+		return imglib.WithModel(m.tile.Image, clrlib.Shift{R: d, G: d, B: d})
+	default:
+		return m.tile.Image
+	}
+}
+
+// overlay draws the original image over the tiled image, if needed.
+func (b Blend) overlay(dst *image.RGBA, img image.Image) {
+	if b.Mode != BlendOverlay || b.Opacity == 0 {
+		return
+	}
+	mask := image.NewUniform(color.Alpha16{A: uint16(b.Opacity * 0xffff)})
+	draw.DrawMask(dst, dst.Bounds(), img, img.Bounds().Min, mask, image.ZP, draw.Over)
+}
@@ -0,0 +1,46 @@
+package tiler
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/posener/tiler/internal/mode"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlendTile(t *testing.T) {
+	t.Parallel()
+
+	rect := image.Rect(0, 0, 4, 4)
+	// Use colors that are not changed by the modes quantization.
+	m := match{
+		tile: mode.New(uniform(rect, color.RGBA{127, 127, 127, 255}), false),
+		box:  mode.New(uniform(rect, color.RGBA{191, 0, 63, 255}), true),
+	}
+
+	tests := []struct {
+		blend Blend
+		want  color.Color
+	}{
+		{blend: Blend{}, want: color.RGBA{127, 127, 127, 255}},
+		{blend: Blend{Mode: BlendOverlay, Opacity: 1}, want: color.RGBA{127, 127, 127, 255}},
+		{blend: Blend{Mode: BlendColor, Opacity: 0}, want: color.RGBA{127, 127, 127, 255}},
+		{blend: Blend{Mode: BlendColor, Opacity: 1}, want: color.NRGBA{191, 0, 63, 255}},
+		{blend: Blend{Mode: BlendColor, Opacity: 0.5}, want: color.NRGBA{159, 64, 95, 255}},
+		{blend: Blend{Mode: BlendLuminance, Opacity: 1}, want: color.NRGBA{45, 45, 45, 255}},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.blend.tile(m).At(0, 0), "%+v", tt.blend)
+	}
+}
+
+func TestBlendOverlay(t *testing.T) {
+	t.Parallel()
+
+	rect := image.Rect(0, 0, 2, 2)
+	dst := uniform(rect, color.Black)
+	Blend{Mode: BlendOverlay, Opacity: 0.5}.overlay(dst, uniform(rect, color.White))
+	assert.InDelta(t, 127, dst.RGBAAt(0, 0).R, 1)
+}
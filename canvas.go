@@ -0,0 +1,171 @@
+package tiler
+
+import (
+	"image"
+	"image/draw"
+	"math"
+
+	"github.com/posener/tiler/internal/imglib"
+	"github.com/posener/tiler/internal/mode"
+)
+
+// canvas is the output image, on which the tiles are placed.
+type canvas struct {
+	*image.RGBA
+	cfg    Config
+	reuse  *reuse
+	update UpdateFn
+	// cache holds the pixels of the tiles. The masks and the pixels of the rotated tiles are kept
+	// within its budget.
+	cache *imglib.Cache
+	// occupied holds the pixels that are covered by tiles, and masks holds the pixels of every
+	// tile, to test for overlaps. The masks bytes are reserved in the cache until release.
+	occupied *imglib.Bitmap
+	masks    map[image.Image]*imglib.Bitmap
+	reserved int64
+	// rotated holds the rotated tiles of the Orient mode, whose pixels are rendered lazily.
+	rotated map[rotation]mode.Mode
+}
+
+// rotation is a tile, rotated by a number of orientSteps.
+type rotation struct {
+	image.Image
+	steps int
+}
+
+// orientSteps is the number of distinct rotations of tiles in the Orient mode.
+const orientSteps = 64
+
+func newCanvas(rect image.Rectangle, cfg Config, cache *imglib.Cache, update UpdateFn) *canvas {
+	return &canvas{
+		RGBA:     image.NewRGBA(rect),
+		cfg:      cfg,
+		reuse:    newReuse(cfg),
+		cache:    cache,
+		update:   update,
+		occupied: imglib.NewBitmap(rect),
+		masks:    make(map[image.Image]*imglib.Bitmap),
+		rotated:  make(map[rotation]mode.Mode),
+	}
+}
+
+// place draws the tile of the match in its location. It returns false if the match could not be
+// placed due to the tiles reuse limits, or since it overlaps previously placed tiles when overlaps
+// are not allowed.
+func (c *canvas) place(m match) bool {
+	tile, ok := c.reuse.choose(m)
+	if !ok {
+		return false
+	}
+	m.tile = tile
+	if m.rotation != 0 {
+		m = c.rotate(m)
+		tile = m.tile
+	}
+	mask := c.mask(tile.Image)
+	if m.shape != nil {
+		mask = shaped(mask, m)
+	}
+	if !c.cfg.Overlap && c.occupied.Intersects(mask, m.location.Min) {
+		return false
+	}
+	c.occupied.Or(mask, m.location.Min)
+	if m.shape != nil {
+		draw.DrawMask(c.RGBA, m.location, c.tile(m), image.ZP, m.shape, m.location.Min.Add(m.shapeOffset), draw.Over)
+	} else {
+		draw.Draw(c.RGBA, m.location, c.tile(m), image.ZP, draw.Over)
+	}
+	c.reuse.use(m)
+	if c.cfg.Placed != nil {
+		c.cfg.Placed(Placement{Source: tile.Source, Rect: m.location, Color: m.box.Color})
+	}
+	c.update(c.RGBA)
+	return true
+}
+
+// mask returns the non-transparent pixels of a tile. Masks are kept if they fit in the budget of
+// the cache, and are computed again otherwise.
+func (c *canvas) mask(tile image.Image) *imglib.Bitmap {
+	if mask := c.masks[tile]; mask != nil {
+		return mask
+	}
+	mask := imglib.Opaque(tile)
+	if c.cache.Reserve(mask.Bytes()) {
+		c.masks[tile] = mask
+		c.reserved += mask.Bytes()
+	} else {
+		c.cache.Reserve(-mask.Bytes())
+	}
+	return mask
+}
+
+// release releases the bytes that the canvas reserved in the cache. The canvas can't be used
+// after it was released.
+func (c *canvas) release() {
+	c.cache.Reserve(-c.reserved)
+	c.reserved = 0
+	c.masks = nil
+}
+
+// shaped returns the pixels of a tile mask that are in the shape of the box of the match, when the
+// tile is placed in the location of the match.
+func shaped(mask *imglib.Bitmap, m match) *imglib.Bitmap {
+	b := imglib.NewBitmap(mask.Rect)
+	for y := mask.Rect.Min.Y; y < mask.Rect.Max.Y; y++ {
+		for x := mask.Rect.Min.X; x < mask.Rect.Max.X; x++ {
+			if !mask.Get(x, y) {
+				continue
+			}
+			p := m.location.Min.Add(m.shapeOffset).Add(image.Pt(x, y))
+			if _, _, _, a := m.shape.At(p.X, p.Y).RGBA(); a > 0 {
+				b.Set(x, y)
+			}
+		}
+	}
+	return b
+}
+
+// rotate returns the match with its tile rotated, and its location resized to the bounds of the
+// rotated tile around the same center.
+func (c *canvas) rotate(m match) match {
+	key := rotation{Image: m.tile.Image, steps: int(math.Round(m.rotation*orientSteps)) % orientSteps}
+	if key.steps == 0 {
+		return m
+	}
+	tile, ok := c.rotated[key]
+	if !ok {
+		// The signature of the tile is kept, since it was matched before it was rotated.
+		src, filter := m.tile.Image, filters[c.cfg.TilesPermute.Filter]
+		render := func() *image.RGBA { return imglib.Rotate(src, float64(key.steps)/orientSteps, filter) }
+		rendered := render()
+		tile = m.tile
+		tile.Image = c.cache.Lazy(rendered.Rect, render, rendered)
+		c.rotated[key] = tile
+	}
+	size := tile.Bounds().Size()
+	center := m.location.Min.Add(m.location.Size().Div(2))
+	m.tile = tile
+	m.location = image.Rectangle{Max: size}.Add(center.Sub(size.Div(2)))
+	return m
+}
+
+// tile returns the image that should be drawn for the given match.
+func (c *canvas) tile(m match) image.Image {
+	m.tile.Image = imglib.Render(m.tile.Image)
+	if c.cfg.Tint {
+		// Blend modes that recolor tiles are rejected with Tint in newTiling.
+		return Blend{Mode: BlendColor, Opacity: 1}.tile(m)
+	}
+	return c.cfg.Blend.tile(m)
+}
+
+// coverage returns the fraction of the non-transparent pixels of the given image that are
+// covered by tiles.
+func (c *canvas) coverage(img image.Image) float64 {
+	opaque := imglib.Opaque(img)
+	total := opaque.Count()
+	if total == 0 {
+		return 1
+	}
+	return float64(opaque.CountAnd(c.occupied)) / float64(total)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"os"
+
+	"github.com/posener/tiler"
+	"github.com/posener/tiler/internal/clrlib"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+)
+
+// glyphs are tiles of font characters.
+type glyphs struct {
+	tiles []image.Image
+	// runes are the characters of the tiles.
+	runes []rune
+	// size is the size of all the tiles.
+	size image.Point
+}
+
+// loadGlyphs rasterizes the characters of the runes flag from the font file of the font flag.
+// Characters that are not in the font are skipped.
+func loadGlyphs(path string) (*glyphs, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := opentype.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("bad font: %w", err)
+	}
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: *fontSize, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, err
+	}
+	defer face.Close()
+
+	fg, err := parseColor(*fontColor)
+	if err != nil {
+		return nil, fmt.Errorf("bad font-color flag: %w", err)
+	}
+	bg, err := parseColor(*fontBackground)
+	if err != nil {
+		return nil, fmt.Errorf("bad font-background flag: %w", err)
+	}
+
+	var (
+		runes []rune
+		buf   sfnt.Buffer
+	)
+	for _, r := range glyphRunes() {
+		// Glyph index 0 is the font's replacement glyph of missing characters.
+		if i, err := f.GlyphIndex(&buf, r); err == nil && i != 0 {
+			runes = append(runes, r)
+		}
+	}
+	tiles, runes := tiler.Glyphs(face, runes, fg, bg)
+	if len(tiles) == 0 {
+		return nil, fmt.Errorf("no characters of the runes flag in the font")
+	}
+	return &glyphs{tiles: tiles, runes: runes, size: tiles[0].Bounds().Size()}, nil
+}
+
+// glyphRunes returns the characters of the runes flag, or the printable ASCII characters if it is
+// empty.
+func glyphRunes() []rune {
+	if *glyphChars != "" {
+		return []rune(*glyphChars)
+	}
+	var runes []rune
+	for r := ' '; r <= '~'; r++ {
+		runes = append(runes, r)
+	}
+	return runes
+}
+
+// text is a grid of characters, one for each glyph cell of the tiled image.
+type text struct {
+	g      *glyphs
+	bounds image.Rectangle
+	cells  [][]tiler.Placement
+}
+
+func newText(g *glyphs, bounds image.Rectangle) *text {
+	rows := (bounds.Dy() + g.size.Y - 1) / g.size.Y
+	cols := (bounds.Dx() + g.size.X - 1) / g.size.X
+	cells := make([][]tiler.Placement, rows)
+	for i := range cells {
+		cells[i] = make([]tiler.Placement, cols)
+		for j := range cells[i] {
+			cells[i][j].Source = -1
+		}
+	}
+	return &text{g: g, bounds: bounds, cells: cells}
+}
+
+// place is a tiler.Config.Placed function. A character is positioned in the cell of the center of
+// its placement, and replaces previous characters in that cell.
+func (t *text) place(p tiler.Placement) {
+	center := p.Rect.Min.Add(p.Rect.Max).Div(2).Sub(t.bounds.Min)
+	row, col := center.Y/t.g.size.Y, center.X/t.g.size.X
+	if center.X < 0 || center.Y < 0 || row >= len(t.cells) || col >= len(t.cells[row]) {
+		return
+	}
+	t.cells[row][col] = p
+}
+
+// save writes the characters grid to a file. If ansi is set, each character is colored by the
+// color of the image area that it was matched to, using ANSI truecolor escape codes.
+func (t *text) save(path string, ansi bool) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	for _, row := range t.cells {
+		for _, p := range row {
+			if p.Source < 0 {
+				w.WriteRune(' ')
+				continue
+			}
+			if ansi {
+				c := clrlib.RGBA(p.Color)
+				fmt.Fprintf(w, "\x1b[38;2;%d;%d;%dm", c.R, c.G, c.B)
+			}
+			w.WriteRune(t.g.runes[p.Source])
+		}
+		if ansi {
+			w.WriteString("\x1b[0m")
+		}
+		w.WriteRune('\n')
+	}
+	return w.Flush()
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/posener/tiler"
+)
+
+// indexVersion is the version of the index file format. Index files of other versions are
+// rebuilt.
+const indexVersion = 1
+
+// tileIndex is an on-disk index of tiles. It stores the signatures of the tiles permutations, such
+// that they are computed only for new or changed tiles. It implements tiler.SignatureStore for the
+// tiles that were loaded by loadTiles.
+type tileIndex struct {
+	Version int
+	// Tiles holds the indexed tiles by their path.
+	Tiles map[string]*indexedTile
+
+	path string
+	mu   sync.Mutex
+	// loaded holds the loaded tiles, in the order of the tiles that loadTiles returned.
+	loaded []*indexedTile
+}
+
+type indexedTile struct {
+	Path string
+	// Hash is the SHA256 of the tile file content.
+	Hash string
+	// Size is the size of the tile image. It is the size of unchanged tiles, which are not decoded
+	// before their pixels are needed.
+	Size image.Point
+	// Signatures holds the signatures of the tile permutations, by the key of the permutations
+	// configuration.
+	Signatures map[string][]tiler.Signature
+}
+
+func runIndex(args []string) {
+	flag.CommandLine.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), `Usage of tiler index:
+
+Indexes a tiles directory into the file of the index flag, and computes the signatures of the
+tiles permutations of the given flags. Running tiler with the same index, tiles and permutation
+flags uses the stored signatures. Only new or changed tiles are indexed again.
+
+`)
+		flag.PrintDefaults()
+	}
+	flag.CommandLine.Parse(args)
+
+	if *tilesPath == "" {
+		log.Fatalf("tiles flag is required.")
+	}
+	if *indexPath == "" {
+		log.Fatalf("index flag is required.")
+	}
+
+	cfg := config()
+	var img image.Image
+	if *imgPath != "" {
+		var err error
+		img, err = loadImage(*imgPath)
+		if err != nil {
+			log.Fatalf("Failed loading image %s: %s", *imgPath, err)
+		}
+	} else if cfg.PaletteSize > 0 {
+		log.Fatalf("palette flag requires the img flag.")
+	}
+
+	index, tiles := loadTilesOrIndex()
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	log.Print("Computing tiles permutations...")
+	permuteCfg := cfg.PermuteConfig(img)
+	permuteCfg.Signatures = index
+	perms, err := tiler.PermuteContext(ctx, tiles, permuteCfg)
+	if err != nil {
+		log.Fatalf("Failed computing permutations: %s", err)
+	}
+	log.Printf("Indexed %d tiles permutations", len(perms))
+
+	err = index.save()
+	if err != nil {
+		log.Fatalf("Failed saving index %q: %s", *indexPath, err)
+	}
+	log.Printf("Done! saved %s.", *indexPath)
+}
+
+// openIndex opens an index file. If the file does not exist, an empty index is returned.
+func openIndex(path string) (*tileIndex, error) {
+	idx := &tileIndex{path: path}
+	data, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, err
+	default:
+		err = json.Unmarshal(data, idx)
+		if err != nil {
+			return nil, fmt.Errorf("bad index file: %w", err)
+		}
+	}
+	if idx.Version != indexVersion || idx.Tiles == nil {
+		idx.Version = indexVersion
+		idx.Tiles = make(map[string]*indexedTile)
+	}
+	return idx, nil
+}
+
+// loadTiles loads the tiles in the given path and updates the index. Tiles that were not changed
+// keep their signatures, and tiles that no longer exist are removed from the index.
+func (idx *tileIndex) loadTiles(path string) ([]image.Image, error) {
+	files, err := readTiles(path, idx)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		images  []image.Image
+		tiles   = make(map[string]*indexedTile, len(files))
+		updated int
+	)
+	idx.loaded = nil
+	for _, f := range files {
+		tile := idx.Tiles[f.path]
+		if tile == nil || tile.Hash != f.hash {
+			tile = &indexedTile{
+				Path:       f.path,
+				Hash:       f.hash,
+				Size:       f.img.Bounds().Size(),
+				Signatures: make(map[string][]tiler.Signature),
+			}
+			updated++
+		}
+		tiles[f.path] = tile
+		images = append(images, f.img)
+		idx.loaded = append(idx.loaded, tile)
+	}
+	removed := 0
+	for path := range idx.Tiles {
+		if tiles[path] == nil {
+			removed++
+		}
+	}
+	log.Printf("Index: %d new or changed tiles, %d removed tiles", updated, removed)
+	idx.Tiles = tiles
+	return images, nil
+}
+
+// size returns the stored size of an indexed tile file if its content has the given hash. It
+// returns false for a nil index.
+func (idx *tileIndex) size(path, hash string) (image.Point, bool) {
+	if idx == nil {
+		return image.Point{}, false
+	}
+	tile := idx.Tiles[path]
+	if tile == nil || tile.Hash != hash || tile.Size == (image.Point{}) {
+		return image.Point{}, false
+	}
+	return tile.Size, true
+}
+
+// Load implements tiler.SignatureStore.
+func (idx *tileIndex) Load(tile int, key string) ([]tiler.Signature, bool) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	sigs, ok := idx.loaded[tile].Signatures[key]
+	return sigs, ok
+}
+
+// Store implements tiler.SignatureStore.
+func (idx *tileIndex) Store(tile int, key string, sigs []tiler.Signature) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.loaded[tile].Signatures[key] = sigs
+}
+
+// lazyTile is the image of an unchanged indexed tile file. The stored signatures of the tile only
+// need its size, so the file is decoded only when the pixels of the tile are needed.
+type lazyTile struct {
+	path string
+	size image.Point
+	once sync.Once
+	img  image.Image
+}
+
+func (t *lazyTile) ColorModel() color.Model { return t.decode().ColorModel() }
+
+func (t *lazyTile) Bounds() image.Rectangle { return image.Rectangle{Max: t.size} }
+
+func (t *lazyTile) At(x, y int) color.Color {
+	img := t.decode()
+	min := img.Bounds().Min
+	return img.At(min.X+x, min.Y+y)
+}
+
+// decode decodes the tile file once. The tile is already used by the tiling at this point, so if
+// the file can't be decoded anymore or its size changed, the failure is reported and the tile is
+// transparent.
+func (t *lazyTile) decode() image.Image {
+	t.once.Do(func() {
+		img, err := loadImage(t.path)
+		if err == nil && img.Bounds().Size() != t.size {
+			err = fmt.Errorf("size changed from %v to %v", t.size, img.Bounds().Size())
+		}
+		if err != nil {
+			log.Printf("Failed decoding tile %q: %s", t.path, err)
+			img = image.NewRGBA(t.Bounds())
+		}
+		t.img = img
+	})
+	return t.img
+}
+
+// save writes the index to its file. The file is replaced only after it was completely written.
+func (idx *tileIndex) save() error {
+	idx.mu.Lock()
+	data, err := json.Marshal(idx)
+	idx.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(idx.path), filepath.Base(idx.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Chmod(0644)
+	}
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), idx.path)
+}
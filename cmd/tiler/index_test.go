@@ -0,0 +1,139 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/posener/tiler"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndexIncremental(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tiler-index")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	tiles, indexPath := filepath.Join(dir, "tiles"), filepath.Join(dir, "index.json")
+	assert.NoError(t, os.Mkdir(tiles, 0755))
+	var (
+		unchanged = filepath.Join(tiles, "a.png")
+		changed   = filepath.Join(tiles, "b.png")
+		removed   = filepath.Join(tiles, "c.png")
+	)
+	writePNG(t, unchanged, color.White)
+	writePNG(t, changed, color.Black)
+	writePNG(t, removed, color.White)
+
+	// Index all the tiles.
+	idx, err := openIndex(indexPath)
+	if !assert.NoError(t, err) {
+		return
+	}
+	images, err := idx.loadTiles(tiles)
+	assert.NoError(t, err)
+	assert.Len(t, images, 3)
+	sig := tiler.Signature{Size: image.Pt(2, 2), Freq: 1, Scale: 1, Flip: tiler.FlipNone}
+	for i := range images {
+		_, ok := idx.Load(i, "key")
+		assert.False(t, ok)
+		idx.Store(i, "key", []tiler.Signature{sig})
+	}
+	assert.NoError(t, idx.save())
+
+	// Change and remove tiles, and load them again from the saved index.
+	writePNG(t, changed, color.Gray{128})
+	assert.NoError(t, os.Remove(removed))
+	idx, err = openIndex(indexPath)
+	if !assert.NoError(t, err) {
+		return
+	}
+	images, err = idx.loadTiles(tiles)
+	assert.NoError(t, err)
+	if !assert.Len(t, images, 2) {
+		return
+	}
+
+	// The unchanged tile is decoded only when its pixels are needed.
+	if lazy, ok := images[0].(*lazyTile); assert.True(t, ok) {
+		assert.Equal(t, image.Rect(0, 0, 2, 2), lazy.Bounds())
+		assert.Nil(t, lazy.img)
+		assert.Equal(t, color.RGBAModel.Convert(color.White), color.RGBAModel.Convert(lazy.At(1, 1)))
+		assert.NotNil(t, lazy.img)
+	}
+	_, lazy := images[1].(*lazyTile)
+	assert.False(t, lazy)
+
+	// The tiles are loaded in the order of their paths.
+	sigs, ok := idx.Load(0, "key")
+	assert.True(t, ok)
+	assert.Equal(t, []tiler.Signature{sig}, sigs)
+	_, ok = idx.Load(1, "key")
+	assert.False(t, ok)
+	assert.NoError(t, idx.save())
+
+	idx, err = openIndex(indexPath)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Len(t, idx.Tiles, 2)
+	if assert.Contains(t, idx.Tiles, unchanged) {
+		assert.Equal(t, []tiler.Signature{sig}, idx.Tiles[unchanged].Signatures["key"])
+	}
+	if assert.Contains(t, idx.Tiles, changed) {
+		assert.Empty(t, idx.Tiles[changed].Signatures)
+	}
+	assert.NotContains(t, idx.Tiles, removed)
+}
+
+func TestOpenIndex(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "tiler-index")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	// A missing index is empty.
+	idx, err := openIndex(filepath.Join(dir, "missing.json"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, indexVersion, idx.Version)
+		assert.Empty(t, idx.Tiles)
+	}
+
+	// An index of another version is rebuilt.
+	old := filepath.Join(dir, "old.json")
+	assert.NoError(t, ioutil.WriteFile(old, []byte(`{"Version":0,"Tiles":{"a.png":{"Hash":"x"}}}`), 0644))
+	idx, err = openIndex(old)
+	if assert.NoError(t, err) {
+		assert.Equal(t, indexVersion, idx.Version)
+		assert.Empty(t, idx.Tiles)
+	}
+
+	bad := filepath.Join(dir, "bad.json")
+	assert.NoError(t, ioutil.WriteFile(bad, []byte("{"), 0644))
+	_, err = openIndex(bad)
+	assert.Error(t, err)
+}
+
+// writePNG writes a 2x2 PNG file of the given color.
+func writePNG(t *testing.T, path string, c color.Color) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 2; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	f, err := os.Create(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer f.Close()
+	assert.NoError(t, png.Encode(f, img))
+}
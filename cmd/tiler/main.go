@@ -1,46 +1,100 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"image"
-	_ "image/gif"
+	"image/color"
+	"image/gif"
 	_ "image/jpeg"
 	"image/png"
+	"io"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/posener/tiler"
 )
 
 var (
 	imgPath   = flag.String("img", "", "Image to tile. Required.")
-	tilesPath = flag.String("tiles", "", "Path to tiles directory or a tile file. Required.")
+	tilesPath = flag.String("tiles", "", "Path to tiles directory or a tile file. Required unless the font flag is used.")
+	fontPath  = flag.String("font", "", "Use the characters of a TTF or OTF font file as tiles, instead of the tiles flag.")
+	textPath  = flag.String("text", "", "Also save the result as text to the given path. Requires the font flag.")
 	outPath   = flag.String("out", "", "Destination path.")
+	include   = flag.String("include", "", "Comma separated glob patterns of tile files to load, matched against their name or their path in the tiles directory.")
+	exclude   = flag.String("exclude", "", "Comma separated glob patterns of tile files to skip, matched against their name or their path in the tiles directory.")
+	maxTiles  = flag.Int("max-tiles", 0, "Maximal number of tile files to load. 0 for unlimited.")
+	skipBad   = flag.Bool("skip-bad", false, "Skip tile files that can't be decoded and report them, instead of failing.")
+	sheetCell = flag.String("sheet-cell", "", "Slice tile files as sprite sheets of cells in the format: 'x,y'.")
+	atlasPath = flag.String("atlas", "", "Slice tile files as sprite sheets by a TexturePacker-style JSON atlas.")
+	indexPath = flag.String("index", "", "Path of a tiles index file, which stores the tiles signatures between runs. See 'tiler index -h'.")
 	shift     = flag.String("shift", "", "Grid shifts in the format: 'x,y'. If omitted, tile size will be used.")
 	colors    = flag.String("colors", "", `Scale tiles colors.
 Use a number 'n' to define number of scales of each color component.
 Use comma separated numbers 'r,g,b' to have different number of scales to each color component.`)
-	scale   = flag.String("scale", "", "Scale tiles. Comma separated list of scale factors.")
-	rotate  = flag.String("rotate", "", "Rotate tiles. Comma separated list of rotations in range [0..1].")
-	overlap = flag.Bool("overlap", false, "Can tiles overlap each other.")
+	fontSize          = flag.Float64("font-size", 16, "Size of the font characters in pixels.")
+	glyphChars        = flag.String("runes", "", "Characters of the font to use as tiles. If omitted, the printable ASCII characters are used.")
+	fontColor         = flag.String("font-color", "#ffffff", "Color of the font characters in the format '#rrggbb' or '#rrggbbaa'.")
+	fontBackground    = flag.String("font-background", "#000000", "Background of the font characters in the format '#rrggbb' or '#rrggbbaa'.")
+	ansi              = flag.Bool("ansi", false, "Color the text of the text flag with ANSI escape codes.")
+	dropTransparent   = flag.Bool("drop-transparent", false, "Drop fully transparent sprites when slicing sprite sheets.")
+	scale             = flag.String("scale", "", "Scale tiles. Comma separated list of scale factors.")
+	rotate            = flag.String("rotate", "", "Rotate tiles. Comma separated list of rotations in range [0..1].")
+	flip              = flag.String("flip", "", "Mirror tiles. Comma separated list of: none, horizontal, vertical, both.")
+	shear             = flag.String("shear", "", "Shear tiles horizontally. Comma separated list of slopes, 0 for no shear.")
+	memoryBudget      = flag.Int64("memory-budget", 0, "Memory budget in megabytes for the tiles permutations. 0 for unlimited.")
+	filter            = flag.String("filter", "bilinear", "Resampling filter for scaling, shearing and rotating tiles. One of: nearest, bilinear, catmull-rom, lanczos.")
+	hue               = flag.String("hue", "", "Rotate tiles hue. Comma separated list of rotations in range [0..1].")
+	saturation        = flag.String("saturation", "", "Scale tiles saturation. Comma separated list of factors.")
+	brightness        = flag.String("brightness", "", "Scale tiles brightness. Comma separated list of factors, above 1 to brighten.")
+	gamma             = flag.String("gamma", "", "Gamma correct tiles. Comma separated list of positive gamma values, above 1 to brighten.")
+	overlap           = flag.Bool("overlap", false, "Can tiles overlap each other.")
+	metric            = flag.String("metric", "rgb", "Color distance metric. One of: rgb, cie76, cie94, ciede2000.")
+	maxUses           = flag.Int("max-uses", 0, "Maximal number of placements of each tile. 0 for unlimited.")
+	repeatDistance    = flag.Float64("repeat-distance", 0, "Minimal distance in pixels between placements of the same tile.")
+	repeatPenalty     = flag.Float64("repeat-penalty", 0, "Distance penalty added to a tile for every time it was placed.")
+	layout            = flag.String("layout", "grid", "Layout of the tiles. One of: grid, quadtree, hex, brick, triangle, poisson.")
+	quadtreeThreshold = flag.Float64("quadtree-threshold", 0.01, "Color variance in range [0..1] above which a region is subdivided in the quadtree layout.")
+	poissonSpacing    = flag.Float64("poisson-spacing", 1, "Minimal distance between tiles centers in the poisson layout, relative to the tile size.")
+	seed              = flag.Int64("seed", 0, "Seed for random layouts.")
+	fillGaps          = flag.Bool("fill-gaps", false, "Fill areas that are not covered by tiles with smaller tiles. Applicable without overlap.")
+	gapColor          = flag.Bool("gap-color", false, "Fill areas that are not covered by tiles with their mean color. Applicable without overlap.")
+	orient            = flag.Bool("orient", false, "Rotate tiles to follow the edges direction of the image.")
+	orientThreshold   = flag.Float64("orient-threshold", 0.2, "Edges coherence in range [0..1] under which tiles are not rotated by the orient flag.")
+	frameStability    = flag.Float64("frame-stability", 0.02, "Distance by which a tile of the previous frame of an animated GIF can exceed the closest tile and still be kept.")
+	grid              = flag.String("grid", "", "Match by a grid of colors in the format: 'x,y'. If omitted, only the most common color is matched.")
+	palette           = flag.Int("palette", 0, "Use a palette of n colors from the image for the tiles colors, instead of the colors flag.")
+	tint              = flag.Bool("tint", false, "Recolor tiles to the colors of the image instead of using color permutations. Can't be used with the color and luminance blend modes.")
+	previewMode       = flag.String("preview", "none", "Preview the tiling in the terminal. One of: none, auto, blocks, kitty, sixel. The auto mode detects kitty and sixel terminals by the KITTY_WINDOW_ID and TERM environment variables.")
+	previewWidth      = flag.Int("preview-width", 0, "Width of the preview in terminal columns. If omitted, the COLUMNS environment variable or 80 is used.")
+	previewRate       = flag.Duration("preview-rate", 200*time.Millisecond, "Minimal duration between redraws of the preview.")
+	blend             = flag.String("blend", "none", "Blend tiles with the image. One of: none, overlay, color, luminance.")
+	blendOpacity      = flag.Float64("blend-opacity", 0.3, "Blending amount in range [0..1].")
+	background        = flag.String("background", "transparent", `Background of the tiles. One of:
+transparent, original, blur[:radius], dim[:amount] or a color in the format '#rrggbb' or '#rrggbbaa'.`)
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "index" {
+		runIndex(os.Args[2:])
+		return
+	}
 	flag.Parse()
 
 	if *imgPath == "" {
 		log.Fatalf("img flag is required.")
 	}
-	if *tilesPath == "" {
-		log.Fatalf("tiles flag is required.")
+	if *tilesPath == "" && *fontPath == "" {
+		log.Fatalf("tiles or font flag is required.")
 	}
-
-	if *outPath == "" {
-		*outPath = "tiled.png"
+	if *textPath != "" && *fontPath == "" {
+		log.Fatalf("text flag requires the font flag.")
 	}
 
 	log.Print("Loading image...")
@@ -48,31 +102,156 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed loading image %s: %s", *imgPath, err)
 	}
-
-	log.Print("Loading tiles...")
-	tiles, err := loadTiles(*tilesPath)
+	anim, err := loadAnimation(*imgPath)
 	if err != nil {
-		log.Fatalf("Failed loading tiles: %s", err)
+		log.Fatalf("Failed loading animation %s: %s", *imgPath, err)
 	}
-	log.Printf("Loaded %d tiles", len(tiles))
 
-	if len(tiles) == 0 {
-		log.Fatal("No tiles found")
+	if *outPath == "" {
+		*outPath = "tiled.png"
+		if anim != nil {
+			*outPath = "tiled.gif"
+		}
+	}
+	if anim != nil && !strings.EqualFold(filepath.Ext(*outPath), ".gif") {
+		log.Fatalf("Animated image requires a .gif output, got %q.", *outPath)
+	}
+	if anim != nil && *textPath != "" {
+		log.Fatalf("text flag is not supported for animated images.")
+	}
+
+	var (
+		index  *tileIndex
+		tiles  []image.Image
+		glyphs *glyphs
+	)
+	if *fontPath != "" {
+		glyphs = loadFont()
+		tiles = glyphs.tiles
+	} else {
+		index, tiles = loadTilesOrIndex()
 	}
 
-	// TODO: add interactive output here.
 	updateFn := func(img image.Image) {}
+	pv, err := newPreview(*previewMode, *previewWidth, *previewRate)
+	if err != nil {
+		log.Fatalf("Bad preview flag: %s", err)
+	}
+	if pv != nil {
+		updateFn = pv.update
+	}
+
+	ctx, cancel := interruptContext()
+	defer cancel()
 
 	cfg := config()
+	if index != nil {
+		cfg.TilesPermute.Signatures = index
+	}
+	var txt *text
+	if *textPath != "" {
+		txt = newText(glyphs, img.Bounds())
+		cfg.Placed = txt.place
+	}
 	log.Printf("Tiling with config: %+v", cfg)
-	out := tiler.Tile(img, tiles, cfg, updateFn)
+	var (
+		out     image.Image
+		outAnim *gif.GIF
+	)
+	if anim != nil {
+		log.Printf("Tiling %d animation frames", len(anim.Image))
+		outAnim, err = tiler.TileGIF(ctx, anim, tiles, cfg, updateFn)
+	} else {
+		out, err = tiler.TileContext(ctx, img, tiles, cfg, updateFn)
+	}
+	if pv != nil {
+		pv.close(out)
+	}
+	if err != nil {
+		log.Fatalf("Failed tiling: %s", err)
+	}
+
+	if index != nil {
+		log.Print("Saving index...")
+		err = index.save()
+		if err != nil {
+			log.Fatalf("Failed saving index %q: %s", *indexPath, err)
+		}
+	}
 
 	log.Print("Saving result...")
-	err = saveImage(*outPath, out)
+	if outAnim != nil {
+		err = saveAnimation(*outPath, outAnim)
+	} else {
+		err = saveImage(*outPath, out)
+	}
 	if err != nil {
 		log.Fatalf("Failed saving output to %q: %s", *outPath, err)
 	}
 	log.Printf("Done! created %s.", *outPath)
+
+	if txt != nil {
+		err = txt.save(*textPath, *ansi)
+		if err != nil {
+			log.Fatalf("Failed saving text to %q: %s", *textPath, err)
+		}
+		log.Printf("Done! created %s.", *textPath)
+	}
+}
+
+// loadFont loads the tiles of the font flag.
+func loadFont() *glyphs {
+	if *tilesPath != "" || *indexPath != "" {
+		log.Fatalf("font flag can't be used with the tiles or index flags.")
+	}
+	log.Print("Loading font...")
+	g, err := loadGlyphs(*fontPath)
+	if err != nil {
+		log.Fatalf("Failed loading font %q: %s", *fontPath, err)
+	}
+	log.Printf("Loaded %d characters in size %v", len(g.tiles), g.size)
+	return g
+}
+
+// loadTilesOrIndex loads the tiles, through the index if it is used.
+func loadTilesOrIndex() (*tileIndex, []image.Image) {
+	var (
+		index *tileIndex
+		tiles []image.Image
+		err   error
+	)
+	log.Print("Loading tiles...")
+	if *indexPath != "" {
+		index, err = openIndex(*indexPath)
+		if err != nil {
+			log.Fatalf("Failed opening index %q: %s", *indexPath, err)
+		}
+		tiles, err = index.loadTiles(*tilesPath)
+	} else {
+		tiles, err = loadTiles(*tilesPath)
+	}
+	if err != nil {
+		log.Fatalf("Failed loading tiles: %s", err)
+	}
+	log.Printf("Loaded %d tiles", len(tiles))
+
+	if len(tiles) == 0 {
+		log.Fatal("No tiles found")
+	}
+	return index, tiles
+}
+
+// interruptContext returns a context that is cancelled on interrupt.
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt)
+		<-sig
+		log.Print("Interrupted, stopping...")
+		cancel()
+	}()
+	return ctx, cancel
 }
 
 func loadImage(path string) (image.Image, error) {
@@ -85,32 +264,36 @@ func loadImage(path string) (image.Image, error) {
 	return img, err
 }
 
-func loadTiles(path string) ([]image.Image, error) {
-	f, err := os.Stat(path)
+// loadAnimation loads an animated GIF. It returns nil if the image is not a GIF or has a single
+// frame.
+func loadAnimation(path string) (*gif.GIF, error) {
+	f, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
-	if !f.IsDir() {
-		img, err := loadImage(path)
-		return []image.Image{img}, err
+	defer f.Close()
+	_, format, err := image.DecodeConfig(f)
+	if err != nil || format != "gif" {
+		return nil, err
+	}
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
 	}
+	g, err := gif.DecodeAll(f)
+	if err != nil || len(g.Image) < 2 {
+		return nil, err
+	}
+	return g, nil
+}
 
-	var images []image.Image
-	err = filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
-		if info.IsDir() {
-			return nil
-		}
-		if !strings.HasSuffix(path, ".png") {
-			return nil
-		}
-		img, err := loadImage(path)
-		if err != nil {
-			return fmt.Errorf("loading tile %q: %w", path, err)
-		}
-		images = append(images, img)
-		return nil
-	})
-	return images, err
+func saveAnimation(path string, g *gif.GIF) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return gif.EncodeAll(f, g)
 }
 
 func saveImage(path string, img image.Image) error {
@@ -125,6 +308,24 @@ func saveImage(path string, img image.Image) error {
 func config() tiler.Config {
 	var cfg tiler.Config
 	cfg.Overlap = *overlap
+	cfg.PaletteSize = *palette
+	cfg.Tint = *tint
+	cfg.Orient = *orient
+	cfg.OrientThreshold = *orientThreshold
+	cfg.FrameStability = *frameStability
+	cfg.TilesPermute.Filter = tiler.Filter(*filter)
+	cfg.TilesPermute.MemoryBudget = *memoryBudget << 20
+	cfg.Blend = tiler.Blend{Mode: tiler.BlendMode(*blend), Opacity: *blendOpacity}
+	cfg.FillGaps = *fillGaps
+	cfg.GapColor = *gapColor
+	cfg.Metric = tiler.Metric(*metric)
+	cfg.Layout = tiler.Layout(*layout)
+	cfg.QuadtreeThreshold = *quadtreeThreshold
+	cfg.PoissonSpacing = *poissonSpacing
+	cfg.Seed = *seed
+	cfg.MaxUses = *maxUses
+	cfg.RepeatDistance = *repeatDistance
+	cfg.RepeatPenalty = *repeatPenalty
 
 	var err error
 	if *colors != "" {
@@ -139,6 +340,16 @@ func config() tiler.Config {
 			log.Fatalf("Bad value for shift: %s", err)
 		}
 	}
+	cfg.Background, err = parseBackground(*background)
+	if err != nil {
+		log.Fatalf("Bad value for background: %s", err)
+	}
+	if *grid != "" {
+		cfg.Grid, err = parsePoint(*grid)
+		if err != nil {
+			log.Fatalf("Bad value for grid: %s", err)
+		}
+	}
 	if *scale != "" {
 		cfg.TilesPermute.Scale, err = parseFloat(*scale)
 		if err != nil {
@@ -151,6 +362,41 @@ func config() tiler.Config {
 			log.Fatalf("Bad value for rotations: %s", err)
 		}
 	}
+	if *flip != "" {
+		for _, f := range strings.Split(*flip, ",") {
+			cfg.TilesPermute.Flip = append(cfg.TilesPermute.Flip, tiler.Flip(f))
+		}
+	}
+	if *shear != "" {
+		cfg.TilesPermute.Shear, err = parseFloat(*shear)
+		if err != nil {
+			log.Fatalf("Bad value for shear: %s", err)
+		}
+	}
+	if *hue != "" {
+		cfg.TilesPermute.Hue, err = parseFloat(*hue)
+		if err != nil {
+			log.Fatalf("Bad value for hue: %s", err)
+		}
+	}
+	if *saturation != "" {
+		cfg.TilesPermute.Saturation, err = parseFloat(*saturation)
+		if err != nil {
+			log.Fatalf("Bad value for saturation: %s", err)
+		}
+	}
+	if *brightness != "" {
+		cfg.TilesPermute.Brightness, err = parseFloat(*brightness)
+		if err != nil {
+			log.Fatalf("Bad value for brightness: %s", err)
+		}
+	}
+	if *gamma != "" {
+		cfg.TilesPermute.Gamma, err = parsePositiveFloat(*gamma)
+		if err != nil {
+			log.Fatalf("Bad value for gamma: %s", err)
+		}
+	}
 	return cfg
 }
 
@@ -186,6 +432,53 @@ func parseColors(s string) (r uint8, g uint8, b uint8, err error) {
 	return
 }
 
+func parseBackground(s string) (tiler.Background, error) {
+	if strings.HasPrefix(s, "#") {
+		c, err := parseColor(s)
+		return tiler.Background{Kind: tiler.BackgroundColor, Color: c}, err
+	}
+	parts := strings.SplitN(s, ":", 2)
+	bg := tiler.Background{Kind: tiler.BackgroundKind(parts[0])}
+	switch bg.Kind {
+	case tiler.BackgroundTransparent, tiler.BackgroundOriginal:
+		if len(parts) > 1 {
+			return bg, fmt.Errorf("%s does not accept a value", bg.Kind)
+		}
+	case tiler.BackgroundBlur, tiler.BackgroundDim:
+		// Default amounts.
+		bg.Amount = 8
+		if bg.Kind == tiler.BackgroundDim {
+			bg.Amount = 0.5
+		}
+		if len(parts) > 1 {
+			var err error
+			bg.Amount, err = strconv.ParseFloat(parts[1], 64)
+			if err != nil {
+				return bg, fmt.Errorf("bad value for %s (%s): %s", bg.Kind, parts[1], err)
+			}
+		}
+	default:
+		return bg, fmt.Errorf("unknown background %q", s)
+	}
+	return bg, nil
+}
+
+// parseColor parses a color in the format '#rrggbb' or '#rrggbbaa'.
+func parseColor(s string) (color.Color, error) {
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) != 6 && len(hex) != 8 {
+		return nil, fmt.Errorf("color must be of the form #rrggbb or #rrggbbaa")
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	n, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("bad color %s: %s", s, err)
+	}
+	return color.NRGBA{R: uint8(n >> 24), G: uint8(n >> 16), B: uint8(n >> 8), A: uint8(n)}, nil
+}
+
 func parseUInt8(s string) (uint8, error) {
 	n, err := strconv.ParseUint(s, 10, 8)
 	if err != nil {
@@ -222,3 +515,16 @@ func parseFloat(s string) ([]float64, error) {
 	}
 	return ret, nil
 }
+
+func parsePositiveFloat(s string) ([]float64, error) {
+	ret, err := parseFloat(s)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range ret {
+		if !(f > 0) {
+			return nil, fmt.Errorf("%v is not positive", f)
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePositiveFloat(t *testing.T) {
+	t.Parallel()
+
+	got, err := parsePositiveFloat("0.5,2")
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{0.5, 2}, got)
+
+	for _, s := range []string{"0", "1,-1", "NaN", "x"} {
+		_, err := parsePositiveFloat(s)
+		assert.Error(t, err, s)
+	}
+}
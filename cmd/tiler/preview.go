@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/image/draw"
+)
+
+// Preview modes of the preview flag.
+const (
+	previewNone   = "none"
+	previewAuto   = "auto"
+	previewBlocks = "blocks"
+	previewKitty  = "kitty"
+	previewSixel  = "sixel"
+)
+
+// cellSize is the assumed size in pixels of a terminal character cell, for rendering images in
+// the kitty and sixel modes.
+var cellSize = image.Pt(8, 16)
+
+// preview renders the tiled image in the terminal while it is being composed. It reserves an area
+// of the terminal for the image and a status line below it, and redraws them at a throttled rate.
+// While the area is shown, log lines are shown in the status line instead of being written to the
+// standard error, and they are written below the area when the preview is closed.
+type preview struct {
+	mode  string
+	w     *bufio.Writer
+	cols  int
+	rate  time.Duration
+	limit int
+
+	mu sync.Mutex
+	// rows is the number of rows of the reserved area, without the status line. It is zero until
+	// the area is reserved.
+	rows int
+	last time.Time
+	logs bytes.Buffer
+}
+
+// newPreview returns a preview for the given mode, or nil if no preview should be shown.
+func newPreview(mode string, cols int, rate time.Duration) (*preview, error) {
+	switch mode {
+	case previewNone, "":
+		return nil, nil
+	case previewAuto:
+		if !isTerminal(os.Stdout) {
+			return nil, nil
+		}
+		mode = autoMode()
+	case previewBlocks, previewKitty, previewSixel:
+	default:
+		return nil, fmt.Errorf("unknown preview mode %q", mode)
+	}
+
+	limit := 0
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		if cols <= 0 || cols > n {
+			cols = n
+		}
+	}
+	if cols <= 0 {
+		cols = 80
+	}
+	if n, err := strconv.Atoi(os.Getenv("LINES")); err == nil && n > 2 {
+		limit = n - 2
+	}
+	return &preview{mode: mode, w: bufio.NewWriter(os.Stdout), cols: cols, rate: rate, limit: limit}, nil
+}
+
+// sixelTerms are TERM values of terminals that support sixel graphics.
+var sixelTerms = []string{"sixel", "mlterm", "foot", "yaft", "contour", "wezterm"}
+
+// autoMode returns the preview mode of the terminal, according to the environment.
+func autoMode() string {
+	term := os.Getenv("TERM")
+	if os.Getenv("KITTY_WINDOW_ID") != "" || strings.Contains(term, "kitty") {
+		return previewKitty
+	}
+	for _, name := range sixelTerms {
+		if strings.Contains(term, name) {
+			return previewSixel
+		}
+	}
+	return previewBlocks
+}
+
+// update is a tiler.UpdateFn. It draws the image if the previous draw is older than the preview
+// rate.
+func (p *preview) update(img image.Image) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if time.Since(p.last) < p.rate {
+		return
+	}
+	p.draw(img)
+}
+
+// close draws the final image and releases the reserved area.
+func (p *preview) close(img image.Image) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if img != nil {
+		p.draw(img)
+	}
+	if p.rows == 0 {
+		return
+	}
+	log.SetOutput(os.Stderr)
+	fmt.Fprintf(p.w, "\x1b8\x1b[%dB\r\x1b[K", p.rows)
+	p.w.Flush()
+	os.Stderr.Write(p.logs.Bytes())
+	p.logs.Reset()
+	p.rows = 0
+}
+
+// Write captures log lines while the reserved area is shown.
+func (p *preview) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.logs.Write(b)
+	if p.rows > 0 {
+		p.status()
+		p.w.Flush()
+	}
+	return len(b), nil
+}
+
+func (p *preview) draw(img image.Image) {
+	p.last = time.Now()
+	cols, rows := p.cells(img.Bounds().Size())
+	if cols < 1 || rows < 1 {
+		return
+	}
+
+	if p.rows == 0 {
+		p.reserve(rows)
+	}
+	fmt.Fprint(p.w, "\x1b8")
+	switch p.mode {
+	case previewKitty:
+		p.kitty(scaleTo(img, image.Pt(cols*cellSize.X, rows*cellSize.Y)), cols, rows)
+	case previewSixel:
+		p.sixel(scaleTo(img, image.Pt(cols*cellSize.X, rows*cellSize.Y)))
+	default:
+		p.blocks(scaleTo(img, image.Pt(cols, 2*rows)))
+	}
+	p.status()
+	p.w.Flush()
+}
+
+// cells returns the number of columns and rows of terminal cells in which an image of the given
+// size is drawn. The image fills the width of the preview, unless its height exceeds the limit.
+func (p *preview) cells(size image.Point) (cols, rows int) {
+	if size.X <= 0 || size.Y <= 0 {
+		return 0, 0
+	}
+	// Each cell holds two square pixels, as in the half block characters.
+	cols, rows = p.cols, (p.cols*size.Y/size.X+1)/2
+	if p.limit > 0 && rows > p.limit {
+		cols, rows = p.cols*p.limit/rows, p.limit
+	}
+	return cols, rows
+}
+
+// reserve reserves an area of the given number of rows and a status line below the cursor, and
+// saves the position of its top left corner.
+func (p *preview) reserve(rows int) {
+	p.rows = rows
+	fmt.Fprintf(p.w, "%s\x1b[%dA\r\x1b7", strings.Repeat("\n", rows+1), rows+1)
+	log.SetOutput(p)
+}
+
+// status writes the last log line in the status line.
+func (p *preview) status() {
+	lines := strings.Split(strings.TrimRight(p.logs.String(), "\n"), "\n")
+	line := lines[len(lines)-1]
+	if runes := []rune(line); len(runes) > p.cols {
+		line = string(runes[:p.cols])
+	}
+	fmt.Fprintf(p.w, "\x1b8\x1b[%dB\r%s\x1b[K\x1b8", p.rows, line)
+}
+
+// blocks draws the image with upper half block characters, in which the foreground color is the
+// top pixel and the background color is the bottom pixel.
+func (p *preview) blocks(img *image.RGBA) {
+	for y := img.Rect.Min.Y; y+1 < img.Rect.Max.Y; y += 2 {
+		for x := img.Rect.Min.X; x < img.Rect.Max.X; x++ {
+			top, bottom := img.RGBAAt(x, y), img.RGBAAt(x, y+1)
+			fmt.Fprintf(p.w, "\x1b[38;2;%d;%d;%dm\x1b[48;2;%d;%d;%dm▀", top.R, top.G, top.B, bottom.R, bottom.G, bottom.B)
+		}
+		fmt.Fprint(p.w, "\x1b[0m\x1b[K\r\n")
+	}
+}
+
+// kitty draws the image using the kitty graphics protocol, scaled to the given number of columns
+// and rows. The image replaces the previously drawn image, and the cursor is not moved.
+func (p *preview) kitty(img *image.RGBA, cols, rows int) {
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	data := base64.StdEncoding.EncodeToString(buf.Bytes())
+
+	fmt.Fprint(p.w, "\x1b_Ga=d,d=I,i=1,q=2\x1b\\")
+	const chunk = 4096
+	for i := 0; i < len(data); i += chunk {
+		end, more := len(data), 0
+		if i+chunk < len(data) {
+			end, more = i+chunk, 1
+		}
+		if i == 0 {
+			fmt.Fprintf(p.w, "\x1b_Ga=T,f=100,i=1,q=2,C=1,c=%d,r=%d,m=%d;%s\x1b\\", cols, rows, more, data[i:end])
+		} else {
+			fmt.Fprintf(p.w, "\x1b_Gm=%d;%s\x1b\\", more, data[i:end])
+		}
+	}
+}
+
+// sixel draws the image in the sixel format, with the 216 colors web-safe palette.
+func (p *preview) sixel(img *image.RGBA) {
+	index := func(x, y int) int { return sixelIndex(img.RGBAAt(x, y)) }
+
+	r := img.Rect
+	fmt.Fprintf(p.w, "\x1bPq\"1;1;%d;%d", r.Dx(), r.Dy())
+	for i := 0; i < sixelLevels*sixelLevels*sixelLevels; i++ {
+		fmt.Fprintf(p.w, "#%d;2;%d;%d;%d", i, i/(sixelLevels*sixelLevels)*20, i/sixelLevels%sixelLevels*20, i%sixelLevels*20)
+	}
+	bits := make([]byte, r.Dx())
+	for y := r.Min.Y; y < r.Max.Y; y += 6 {
+		used := make(map[int]bool)
+		for dy := 0; dy < 6 && y+dy < r.Max.Y; dy++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				used[index(x, y+dy)] = true
+			}
+		}
+		for c := range used {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				var b byte
+				for dy := 0; dy < 6 && y+dy < r.Max.Y; dy++ {
+					if index(x, y+dy) == c {
+						b |= 1 << uint(dy)
+					}
+				}
+				bits[x-r.Min.X] = b
+			}
+			fmt.Fprintf(p.w, "#%d", c)
+			writeSixels(p.w, bits)
+			fmt.Fprint(p.w, "$")
+		}
+		fmt.Fprint(p.w, "-")
+	}
+	fmt.Fprint(p.w, "\x1b\\")
+}
+
+// sixelLevels is the number of levels of each color component in the sixel palette.
+const sixelLevels = 6
+
+// sixelIndex returns the index of the closest color in the sixel palette, in which the index of a
+// color is its red, green and blue levels as digits in base sixelLevels.
+func sixelIndex(c color.RGBA) int {
+	level := func(v uint8) int { return (int(v) + 25) / 51 }
+	return level(c.R)*sixelLevels*sixelLevels + level(c.G)*sixelLevels + level(c.B)
+}
+
+// writeSixels writes a row of sixels with run length encoding.
+func writeSixels(w io.Writer, bits []byte) {
+	for i := 0; i < len(bits); {
+		j := i
+		for j < len(bits) && bits[j] == bits[i] {
+			j++
+		}
+		c := '?' + bits[i]
+		if n := j - i; n > 3 {
+			fmt.Fprintf(w, "!%d%c", n, c)
+		} else {
+			fmt.Fprint(w, strings.Repeat(string(c), n))
+		}
+		i = j
+	}
+}
+
+// scaleTo returns the image scaled to the given size. Transparent areas become black.
+func scaleTo(img image.Image, size image.Point) *image.RGBA {
+	dst := image.NewRGBA(image.Rectangle{Max: size})
+	draw.ApproxBiLinear.Scale(dst, dst.Rect, img, img.Bounds(), draw.Src, nil)
+	for i := 3; i < len(dst.Pix); i += 4 {
+		dst.Pix[i] = 0xff
+	}
+	return dst
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"image"
+	"image/color"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteSixels(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		bits []byte
+		want string
+	}{
+		{bits: nil, want: ""},
+		{bits: []byte{0}, want: "?"},
+		{bits: []byte{1, 1, 1}, want: "@@@"},
+		// Runs longer than 3 are run length encoded.
+		{bits: []byte{63, 63, 63, 63}, want: "!4~"},
+		{bits: []byte{0, 0, 0, 0, 0, 1, 1, 2, 2, 2, 2, 2, 2}, want: "!5?@@!6A"},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		writeSixels(&buf, tt.bits)
+		assert.Equal(t, tt.want, buf.String(), "%v", tt.bits)
+	}
+}
+
+func TestSixelIndex(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		c    color.RGBA
+		want int
+	}{
+		{c: color.RGBA{0, 0, 0, 255}, want: 0},
+		{c: color.RGBA{255, 255, 255, 255}, want: 215},
+		{c: color.RGBA{255, 0, 0, 255}, want: 180},
+		{c: color.RGBA{0, 255, 0, 255}, want: 30},
+		{c: color.RGBA{0, 0, 255, 255}, want: 5},
+		// Components are rounded to the closest level.
+		{c: color.RGBA{25, 26, 76, 255}, want: 0*36 + 1*6 + 1},
+		{c: color.RGBA{77, 128, 230, 255}, want: 2*36 + 3*6 + 5},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, sixelIndex(tt.c), "%v", tt.c)
+	}
+
+	// The palette entry of the index is the color levels in percents.
+	var buf bytes.Buffer
+	p := &preview{w: bufio.NewWriter(&buf)}
+	img := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	img.SetRGBA(0, 0, color.RGBA{255, 102, 0, 255})
+	p.sixel(img)
+	p.w.Flush()
+	assert.Contains(t, buf.String(), "#192;2;100;40;0#")
+	assert.Contains(t, buf.String(), "#192@$-\x1b\\")
+}
+
+func TestPreviewCells(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		cols, limit int
+		size        image.Point
+		wantCols    int
+		wantRows    int
+	}{
+		{name: "square", cols: 80, size: image.Pt(160, 160), wantCols: 80, wantRows: 40},
+		{name: "wide", cols: 80, size: image.Pt(400, 100), wantCols: 80, wantRows: 10},
+		{name: "rounded up", cols: 10, size: image.Pt(10, 3), wantCols: 10, wantRows: 2},
+		{name: "below limit", cols: 80, limit: 40, size: image.Pt(160, 160), wantCols: 80, wantRows: 40},
+		{name: "above limit", cols: 80, limit: 20, size: image.Pt(160, 160), wantCols: 40, wantRows: 20},
+		{name: "tall", cols: 80, limit: 10, size: image.Pt(10, 1000), wantCols: 0, wantRows: 10},
+		{name: "empty", cols: 80, size: image.Pt(0, 10), wantCols: 0, wantRows: 0},
+	}
+
+	for _, tt := range tests {
+		p := &preview{cols: tt.cols, limit: tt.limit}
+		cols, rows := p.cells(tt.size)
+		assert.Equal(t, tt.wantCols, cols, tt.name)
+		assert.Equal(t, tt.wantRows, rows, tt.name)
+	}
+}
+
+func TestPreviewStatus(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	p := &preview{w: bufio.NewWriter(&buf), cols: 5, rows: 3}
+	p.logs.WriteString("first\nnaïve résumé\n")
+	p.status()
+	p.w.Flush()
+	// The last line is truncated to the preview width by characters.
+	assert.Equal(t, "\x1b8\x1b[3B\rnaïve\x1b[K\x1b8", buf.String())
+}
+
+func TestNewPreview(t *testing.T) {
+	defer setEnv("COLUMNS", "100")()
+	defer setEnv("LINES", "30")()
+
+	for _, mode := range []string{"", previewNone} {
+		p, err := newPreview(mode, 0, 0)
+		assert.NoError(t, err)
+		assert.Nil(t, p)
+	}
+
+	for _, mode := range []string{previewBlocks, previewKitty, previewSixel} {
+		p, err := newPreview(mode, 0, 0)
+		if assert.NoError(t, err) && assert.NotNil(t, p) {
+			assert.Equal(t, mode, p.mode)
+			assert.Equal(t, 100, p.cols)
+			assert.Equal(t, 28, p.limit)
+		}
+	}
+
+	// The width is limited by the terminal width.
+	p, err := newPreview(previewBlocks, 60, 0)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 60, p.cols)
+	}
+	p, err = newPreview(previewBlocks, 120, 0)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 100, p.cols)
+	}
+
+	// Without the terminal size, the default width is used with no height limit.
+	defer setEnv("COLUMNS", "")()
+	defer setEnv("LINES", "")()
+	p, err = newPreview(previewBlocks, 0, 0)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 80, p.cols)
+		assert.Equal(t, 0, p.limit)
+	}
+
+	_, err = newPreview("unknown", 0, 0)
+	assert.Error(t, err)
+}
+
+func TestAutoMode(t *testing.T) {
+	defer setEnv("KITTY_WINDOW_ID", "")()
+	defer setEnv("TERM", "xterm-256color")()
+	assert.Equal(t, previewBlocks, autoMode())
+
+	os.Setenv("TERM", "xterm-kitty")
+	assert.Equal(t, previewKitty, autoMode())
+
+	for _, term := range []string{"foot", "mlterm", "xterm-sixel"} {
+		os.Setenv("TERM", term)
+		assert.Equal(t, previewSixel, autoMode(), term)
+	}
+
+	os.Setenv("TERM", "xterm-256color")
+	os.Setenv("KITTY_WINDOW_ID", "1")
+	assert.Equal(t, previewKitty, autoMode())
+}
+
+// setEnv sets an environment variable, and returns a function that restores it.
+func setEnv(key, value string) func() {
+	old, ok := os.LookupEnv(key)
+	os.Setenv(key, value)
+	return func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/posener/tiler"
+
+	// Decoders of the supported tile formats, in addition to the standard library ones.
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// tileExts are the extensions of the supported tile files.
+var tileExts = map[string]bool{
+	".png":  true,
+	".jpg":  true,
+	".jpeg": true,
+	".gif":  true,
+	".bmp":  true,
+	".tif":  true,
+	".tiff": true,
+	".webp": true,
+}
+
+// errMaxTiles stops walking the tiles directory when max-tiles files were found.
+var errMaxTiles = errors.New("max tiles")
+
+// tileFile is a decoded tile file.
+type tileFile struct {
+	// path is the path of the tile file. For frames of an animated GIF and for sprites of a sprite
+	// sheet it is suffixed by '#' and the frame or sprite name.
+	path string
+	// hash is the SHA256 of the file content. For sprites it also covers the area of the sprite in
+	// the sheet.
+	hash string
+	img  image.Image
+}
+
+func loadTiles(path string) ([]image.Image, error) {
+	files, err := readTiles(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	images := make([]image.Image, 0, len(files))
+	for _, f := range files {
+		images = append(images, f.img)
+	}
+	return images, nil
+}
+
+// readTiles reads and decodes the tile files in the given path in parallel. The files are
+// returned in the order of their paths, and each frame of an animated GIF is a separate tile. If
+// the skip-bad flag is set, files that can't be decoded are reported and skipped. Files that are
+// unchanged in the given index, which may be nil, are decoded only when their pixels are needed.
+func readTiles(path string, idx *tileIndex) ([]tileFile, error) {
+	paths, err := tilePaths(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		files = make([][]tileFile, len(paths))
+		errs  = make([]error, len(paths))
+		jobs  = make(chan int)
+		wg    sync.WaitGroup
+	)
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				files[i], errs[i] = readTile(paths[i], idx)
+			}
+		}()
+	}
+	for i := range paths {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	var (
+		good []tileFile
+		bad  int
+	)
+	for i, f := range files {
+		if errs[i] == nil {
+			good = append(good, f...)
+			continue
+		}
+		if !*skipBad {
+			return nil, fmt.Errorf("loading tile %q: %w", paths[i], errs[i])
+		}
+		log.Printf("Skipping tile %q: %s", paths[i], errs[i])
+		bad++
+	}
+	if bad > 0 {
+		log.Printf("Skipped %d bad tiles", bad)
+	}
+	return sliceSheets(good)
+}
+
+// sliceSheets slices the tile files into sprites when the sheet-cell or atlas flags are set.
+func sliceSheets(files []tileFile) ([]tileFile, error) {
+	if *sheetCell == "" && *atlasPath == "" {
+		return files, nil
+	}
+	if *sheetCell != "" && *atlasPath != "" {
+		return nil, fmt.Errorf("sheet-cell and atlas flags are mutually exclusive")
+	}
+
+	var sprites func(bounds image.Rectangle) ([]tiler.Sprite, error)
+	if *sheetCell != "" {
+		cell, err := parsePoint(*sheetCell)
+		if err != nil {
+			return nil, fmt.Errorf("bad sheet-cell flag: %w", err)
+		}
+		sprites = func(bounds image.Rectangle) ([]tiler.Sprite, error) {
+			return tiler.GridSprites(bounds, cell)
+		}
+	} else {
+		atlas, err := loadAtlas(*atlasPath)
+		if err != nil {
+			return nil, fmt.Errorf("loading atlas %q: %w", *atlasPath, err)
+		}
+		sprites = func(image.Rectangle) ([]tiler.Sprite, error) { return atlas.Sprites, nil }
+	}
+
+	var sliced []tileFile
+	for _, f := range files {
+		all, err := sprites(f.img.Bounds())
+		if err != nil {
+			return nil, err
+		}
+		kept, tiles := tiler.SliceSheet(f.img, all, *dropTransparent)
+		for i, sprite := range kept {
+			sliced = append(sliced, tileFile{path: f.path + "#" + sprite.Name, hash: spriteHash(f.hash, sprite), img: tiles[i]})
+		}
+		log.Printf("Sliced %d sprites from %q", len(kept), f.path)
+	}
+	return sliced, nil
+}
+
+// spriteHash returns the hash of a sprite, which changes when the sheet file changes or when the
+// sprite is moved or rotated in the sheet.
+func spriteHash(sheetHash string, sprite tiler.Sprite) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s %v %t", sheetHash, sprite.Rect, sprite.Rotated)))
+	return hex.EncodeToString(sum[:])
+}
+
+func loadAtlas(path string) (tiler.Atlas, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return tiler.Atlas{}, err
+	}
+	defer f.Close()
+	return tiler.ParseAtlas(f)
+}
+
+func readTile(path string, idx *tileIndex) ([]tileFile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	if size, ok := idx.size(path, hash); ok {
+		return []tileFile{{path: path, hash: hash, img: &lazyTile{path: path, size: size}}}, nil
+	}
+
+	if _, format, _ := image.DecodeConfig(bytes.NewReader(data)); format == "gif" {
+		g, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if len(g.Image) > 1 {
+			var files []tileFile
+			for i, frame := range tiler.GIFFrames(g) {
+				files = append(files, tileFile{path: fmt.Sprintf("%s#frame-%d", path, i), hash: hash, img: frame})
+			}
+			return files, nil
+		}
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return []tileFile{{path: path, hash: hash, img: img}}, nil
+}
+
+// tilePaths returns the paths of the tiles in the given path, which is a tiles directory or a
+// tile file. Files in a directory are filtered by their extension and by the include, exclude and
+// max-tiles flags.
+func tilePaths(path string) ([]string, error) {
+	f, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !f.IsDir() {
+		return []string{path}, nil
+	}
+
+	includes, excludes := patterns(*include), patterns(*exclude)
+	var paths []string
+	err = filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if !tileExts[strings.ToLower(filepath.Ext(file))] {
+			return nil
+		}
+		rel, err := filepath.Rel(path, file)
+		if err != nil {
+			return err
+		}
+		if len(includes) > 0 && !matchAny(includes, rel) {
+			return nil
+		}
+		if matchAny(excludes, rel) {
+			return nil
+		}
+		if *maxTiles > 0 && len(paths) == *maxTiles {
+			return errMaxTiles
+		}
+		paths = append(paths, file)
+		return nil
+	})
+	if err == errMaxTiles {
+		err = nil
+	}
+	return paths, err
+}
+
+// patterns returns the comma separated glob patterns in the given string.
+func patterns(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+// matchAny returns whether the name or the path of a file match any of the given patterns.
+func matchAny(patterns []string, path string) bool {
+	for _, pattern := range patterns {
+		for _, name := range []string{filepath.Base(path), path} {
+			if ok, _ := filepath.Match(pattern, name); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
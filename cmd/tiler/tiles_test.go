@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/posener/tiler"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpriteHash(t *testing.T) {
+	t.Parallel()
+
+	sprite := tiler.Sprite{Name: "a", Rect: image.Rect(0, 0, 4, 4)}
+	hash := spriteHash("sheet", sprite)
+	assert.Equal(t, hash, spriteHash("sheet", sprite))
+
+	moved := sprite
+	moved.Rect = image.Rect(4, 0, 8, 4)
+	rotated := sprite
+	rotated.Rotated = true
+	assert.NotEqual(t, hash, spriteHash("sheet", moved))
+	assert.NotEqual(t, hash, spriteHash("sheet", rotated))
+	assert.NotEqual(t, hash, spriteHash("other", sprite))
+}
+
+const testTiles = "testdata/tiles"
+
+func TestTilePaths(t *testing.T) {
+	tests := []struct {
+		name             string
+		include, exclude string
+		maxTiles         int
+		want             []string
+	}{
+		{
+			name: "all",
+			want: []string{"a.png", "b.JPG", "bad.png", "nested/c.gif", "nested/deep/d.bmp"},
+		},
+		{
+			name:    "include extension",
+			include: "*.png",
+			want:    []string{"a.png", "bad.png"},
+		},
+		{
+			name:    "include base name of nested file",
+			include: "d.bmp",
+			want:    []string{"nested/deep/d.bmp"},
+		},
+		{
+			name:    "include relative path",
+			include: "nested/*",
+			want:    []string{"nested/c.gif"},
+		},
+		{
+			name:    "include nested relative path",
+			include: "nested/*/*.bmp",
+			want:    []string{"nested/deep/d.bmp"},
+		},
+		{
+			name:    "exclude",
+			exclude: "bad.png,*.gif",
+			want:    []string{"a.png", "b.JPG", "nested/deep/d.bmp"},
+		},
+		{
+			name:    "exclude relative path",
+			exclude: "nested/deep/*",
+			want:    []string{"a.png", "b.JPG", "bad.png", "nested/c.gif"},
+		},
+		{
+			name:     "max tiles",
+			maxTiles: 2,
+			want:     []string{"a.png", "b.JPG"},
+		},
+		{
+			name:     "max tiles after filters",
+			include:  "*.gif,*.bmp",
+			maxTiles: 1,
+			want:     []string{"nested/c.gif"},
+		},
+		{
+			name:     "max tiles above count",
+			maxTiles: 10,
+			want:     []string{"a.png", "b.JPG", "bad.png", "nested/c.gif", "nested/deep/d.bmp"},
+		},
+	}
+
+	for _, tt := range tests {
+		restore := setFlags(tt.include, tt.exclude, tt.maxTiles, false)
+		paths, err := tilePaths(testTiles)
+		restore()
+		if !assert.NoError(t, err, tt.name) {
+			continue
+		}
+		var got []string
+		for _, path := range paths {
+			rel, err := filepath.Rel(testTiles, path)
+			assert.NoError(t, err)
+			got = append(got, filepath.ToSlash(rel))
+		}
+		assert.Equal(t, tt.want, got, tt.name)
+	}
+
+	// A tile file is used as is.
+	paths, err := tilePaths(filepath.Join(testTiles, "notes.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(testTiles, "notes.txt")}, paths)
+
+	_, err = tilePaths(filepath.Join(testTiles, "missing"))
+	assert.Error(t, err)
+}
+
+func TestMatchAny(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		patterns []string
+		path     string
+		want     bool
+	}{
+		{patterns: nil, path: "a.png", want: false},
+		{patterns: []string{"*.png"}, path: "a.png", want: true},
+		{patterns: []string{"*.png"}, path: "dir/a.png", want: true},
+		{patterns: []string{"*.png"}, path: "a.PNG", want: false},
+		{patterns: []string{"dir/*.png"}, path: "dir/a.png", want: true},
+		{patterns: []string{"dir/*.png"}, path: "dir/sub/a.png", want: false},
+		{patterns: []string{"*/a.png"}, path: "dir/a.png", want: true},
+		{patterns: []string{"*.jpg", "a.*"}, path: "dir/a.png", want: true},
+		{patterns: []string{"[", "b.png"}, path: "b.png", want: true},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, matchAny(tt.patterns, filepath.FromSlash(tt.path)), "%v %s", tt.patterns, tt.path)
+	}
+}
+
+func TestReadTiles(t *testing.T) {
+	// Without the skip-bad flag, a corrupt file fails the loading.
+	restore := setFlags("", "", 0, false)
+	_, err := readTiles(testTiles, nil)
+	restore()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "bad.png")
+	}
+
+	// With the skip-bad flag, corrupt files are reported and skipped.
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+	restore = setFlags("", "", 0, true)
+	defer restore()
+
+	want := []string{"a.png", "b.JPG", "nested/c.gif", "nested/deep/d.bmp"}
+	// The tiles are decoded in parallel, and returned in the order of their paths.
+	for i := 0; i < 10; i++ {
+		files, err := readTiles(testTiles, nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+		if !assert.Len(t, files, len(want)) {
+			return
+		}
+		for j, f := range files {
+			assert.Equal(t, filepath.Join(testTiles, want[j]), f.path)
+			assert.NotEmpty(t, f.hash)
+			// The tiles sizes are their positions in the list.
+			assert.Equal(t, image.Rect(0, 0, j+1, j+1), f.img.Bounds(), f.path)
+		}
+	}
+	assert.Contains(t, logs.String(), `Skipping tile "`+filepath.Join(testTiles, "bad.png")+`"`)
+	assert.Contains(t, logs.String(), "Skipped 1 bad tiles")
+}
+
+// setFlags sets the flags of the tiles selection, and returns a function that restores them.
+func setFlags(includeFlag, excludeFlag string, maxTilesFlag int, skipBadFlag bool) func() {
+	oldInclude, oldExclude, oldMaxTiles, oldSkipBad := *include, *exclude, *maxTiles, *skipBad
+	*include, *exclude, *maxTiles, *skipBad = includeFlag, excludeFlag, maxTilesFlag, skipBadFlag
+	return func() {
+		*include, *exclude, *maxTiles, *skipBad = oldInclude, oldExclude, oldMaxTiles, oldSkipBad
+	}
+}
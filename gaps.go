@@ -0,0 +1,72 @@
+package tiler
+
+import (
+	"context"
+	"image"
+
+	"github.com/posener/tiler/internal/imglib"
+	"github.com/posener/tiler/internal/mode"
+)
+
+// fillGaps fills the non-transparent areas of the image that are not covered by tiles in the
+// canvas. The tile groups should be sorted from the largest tiles to the smallest.
+func fillGaps(ctx context.Context, img image.Image, c *canvas, groups []tileGroup, logf func(string, ...interface{})) error {
+	if c.cfg.FillGaps {
+		placed := 0
+		for _, g := range groups {
+			gaps := c.gaps(img)
+			full := imglib.Filled(image.Rectangle{Max: g.size})
+			step := image.Pt(max(g.size.X/2, 1), max(g.size.Y/2, 1))
+			rect := img.Bounds()
+			for y := rect.Min.Y; y < rect.Max.Y; y += step.Y {
+				for x := rect.Min.X; x < rect.Max.X; x += step.X {
+					if err := ctx.Err(); err != nil {
+						return err
+					}
+					min := image.Pt(x, y)
+					if !gaps.Intersects(full, min) {
+						continue
+					}
+					m, ok := g.match(imglib.SubImage(img, image.Rectangle{Min: min, Max: min.Add(g.size)}), c.cfg)
+					if ok && c.place(m) {
+						placed++
+					}
+				}
+			}
+		}
+		logf("Filled gaps with %d tiles", placed)
+	}
+
+	if c.cfg.GapColor && len(groups) > 0 {
+		// Fill the gaps with the mean color of the cells of the smallest tile size they are in.
+		gaps := c.gaps(img)
+		size := groups[len(groups)-1].size
+		for i := imglib.Iterate(img.Bounds(), &size); i.Next(); {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			cell := image.Rectangle{Min: i.Point, Max: i.Add(size)}.Intersect(img.Bounds())
+			if cell.Empty() || !gaps.Intersects(imglib.Filled(image.Rectangle{Max: cell.Size()}), cell.Min) {
+				continue
+			}
+			mean := mode.New(imglib.SubImage(img, cell), true).WithGrid(image.Pt(1, 1)).Grid[0]
+			for y := cell.Min.Y; y < cell.Max.Y; y++ {
+				for x := cell.Min.X; x < cell.Max.X; x++ {
+					if gaps.Get(x, y) {
+						c.Set(x, y, mean)
+						c.occupied.Set(x, y)
+					}
+				}
+			}
+		}
+		c.update(c.RGBA)
+	}
+	return nil
+}
+
+// gaps returns the non-transparent pixels of the image that are not covered by tiles.
+func (c *canvas) gaps(img image.Image) *imglib.Bitmap {
+	gaps := imglib.Opaque(img)
+	gaps.AndNot(c.occupied)
+	return gaps
+}
@@ -0,0 +1,47 @@
+package tiler
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/posener/tiler/internal/imglib"
+	"github.com/posener/tiler/internal/mode"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFillGaps(t *testing.T) {
+	t.Parallel()
+
+	img := uniform(image.Rect(0, 0, 8, 8), color.White)
+	// Tiles that are opaque only in their left half.
+	var tiles []mode.Mode
+	for _, size := range []int{4, 2} {
+		tile := image.NewRGBA(image.Rect(0, 0, size, size))
+		draw.Draw(tile, image.Rect(0, 0, size/2, size), image.NewUniform(color.White), image.ZP, draw.Src)
+		tiles = append(tiles, mode.New(tile, false))
+	}
+	logf := func(string, ...interface{}) {}
+
+	tests := []struct {
+		name string
+		cfg  Config
+		want float64
+	}{
+		{name: "no fill", cfg: Config{}, want: 0.5},
+		{name: "fill gaps", cfg: Config{FillGaps: true}, want: 1},
+		{name: "gap color", cfg: Config{GapColor: true}, want: 1},
+	}
+
+	for _, tt := range tests {
+		groups := groupTiles(tiles, tt.cfg, metrics[MetricRGB])
+		matches, err := computeMatches(context.Background(), img, groups[:1], tt.cfg)
+		assert.NoError(t, err)
+		c := newCanvas(img.Bounds(), tt.cfg, imglib.NewCache(0), func(image.Image) {})
+		assert.NoError(t, composeMatches(context.Background(), c, matches, logf))
+		assert.NoError(t, fillGaps(context.Background(), img, c, groups, logf))
+		assert.Equal(t, tt.want, c.coverage(img), tt.name)
+	}
+}
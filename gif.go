@@ -0,0 +1,171 @@
+package tiler
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+
+	"github.com/posener/tiler/internal/clrlib"
+	"github.com/posener/tiler/internal/mode"
+)
+
+// GIFFrames returns the frames of an animated GIF as they are displayed. Each frame is drawn over
+// the previous ones according to their disposal methods, and is in the size of the GIF.
+func GIFFrames(g *gif.GIF) []image.Image {
+	bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	if bounds.Empty() {
+		for _, frame := range g.Image {
+			bounds = bounds.Union(frame.Bounds())
+		}
+	}
+
+	var (
+		frames = make([]image.Image, 0, len(g.Image))
+		canvas = image.NewRGBA(bounds)
+	)
+	for i, frame := range g.Image {
+		var disposal byte
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		var restore *image.RGBA
+		if disposal == gif.DisposalPrevious {
+			restore = image.NewRGBA(bounds)
+			copy(restore.Pix, canvas.Pix)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		out := image.NewRGBA(bounds)
+		copy(out.Pix, canvas.Pix)
+		frames = append(frames, out)
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = restore
+		}
+	}
+	return frames
+}
+
+// TileGIF tiles each frame of an animated GIF, and returns the tiled animation. The tiles
+// permutations are computed once, using the first frame for configurations that are derived from
+// the tiled image. Tiles are kept stable between frames according to cfg.FrameStability. The
+// update function is called with the tiled frames.
+func TileGIF(ctx context.Context, g *gif.GIF, tiles []image.Image, cfg Config, update UpdateFn) (*gif.GIF, error) {
+	frames := GIFFrames(g)
+	if len(frames) == 0 || frames[0].Bounds().Empty() {
+		return nil, ErrEmptyImage
+	}
+	t, err := newTiling(ctx, frames[0], tiles, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return t.tileGIF(ctx, g, frames, update)
+}
+
+// tileGIF tiles the composited frames of an animated GIF.
+func (t *tiling) tileGIF(ctx context.Context, g *gif.GIF, frames []image.Image, update UpdateFn) (*gif.GIF, error) {
+	out := &gif.GIF{
+		LoopCount: g.LoopCount,
+		Config: image.Config{
+			Width:  frames[0].Bounds().Dx(),
+			Height: frames[0].Bounds().Dy(),
+		},
+	}
+	var prev map[image.Rectangle]mode.Mode
+	for i, frame := range frames {
+		t.logf("Tiling frame %d/%d...", i+1, len(frames))
+		var (
+			tiled *image.RGBA
+			err   error
+		)
+		tiled, prev, err = t.tile(ctx, frame, prev, update)
+		if err != nil {
+			return nil, err
+		}
+		out.Image = append(out.Image, paletted(tiled))
+		// The tiled frames replace each other completely, including their transparent areas.
+		out.Disposal = append(out.Disposal, gif.DisposalBackground)
+		var delay int
+		if i < len(g.Delay) {
+			delay = g.Delay[i]
+		}
+		out.Delay = append(out.Delay, delay)
+	}
+	return out, nil
+}
+
+// stabilize replaces the tiles of the matches with the tiles that were matched to the same
+// locations in a previous frame, if they are close enough to the current frame.
+func stabilize(matches []match, prev map[image.Rectangle]mode.Mode, cfg Config, metric metricFuncs) {
+	for i, m := range matches {
+		tile, ok := prev[m.location]
+		if !ok {
+			continue
+		}
+		dist := m.box.Distance(tile, metric.distance)
+		if cfg.Tint {
+			dist = m.box.TintDistance(tile, metric.distance)
+		}
+		if dist <= m.distance+cfg.FrameStability {
+			matches[i].tile, matches[i].distance = tile, dist
+		}
+	}
+}
+
+// paletted converts an image to a paletted image with a palette that is extracted from its
+// colors. Pixels that are mostly transparent are converted to a transparent color, since GIF has
+// no partial transparency.
+func paletted(img *image.RGBA) *image.Paletted {
+	var (
+		hist        = make(map[color.RGBA]int)
+		transparent bool
+	)
+	for i := 0; i < len(img.Pix); i += 4 {
+		c := color.RGBA{img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3]}
+		if c.A < 0x80 {
+			transparent = true
+			continue
+		}
+		c.A = 0xff
+		hist[c]++
+	}
+
+	var p color.Palette
+	if transparent {
+		p = append(p, color.Transparent)
+	}
+	p = append(p, clrlib.MedianCut(hist, 256-len(p))...)
+
+	out := image.NewPaletted(img.Bounds(), p)
+	indices := make(map[color.RGBA]uint8)
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		for x := img.Rect.Min.X; x < img.Rect.Max.X; x++ {
+			c := img.RGBAAt(x, y)
+			if c.A < 0x80 {
+				out.SetColorIndex(x, y, 0)
+				continue
+			}
+			c.A = 0xff
+			index, ok := indices[c]
+			if !ok {
+				index = uint8(nearest(p, c, transparent))
+				indices[c] = index
+			}
+			out.SetColorIndex(x, y, index)
+		}
+	}
+	return out
+}
+
+// nearest returns the index of the closest opaque palette color to the given color.
+func nearest(p color.Palette, c color.RGBA, skipFirst bool) int {
+	if !skipFirst {
+		return p.Index(c)
+	}
+	return 1 + p[1:].Index(c)
+}
@@ -0,0 +1,143 @@
+package tiler
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGIFFrames(t *testing.T) {
+	t.Parallel()
+
+	red := color.RGBA{255, 0, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+	green := color.RGBA{0, 255, 0, 255}
+	frame := func(rect image.Rectangle, c color.Color) *image.Paletted {
+		return image.NewPaletted(rect, color.Palette{c})
+	}
+
+	g := &gif.GIF{
+		Image: []*image.Paletted{
+			frame(image.Rect(0, 0, 4, 4), red),
+			frame(image.Rect(0, 0, 2, 2), blue),
+			frame(image.Rect(2, 2, 4, 4), green),
+			frame(image.Rect(0, 3, 1, 4), blue),
+		},
+		Disposal: []byte{gif.DisposalNone, gif.DisposalBackground, gif.DisposalPrevious, gif.DisposalNone},
+		Config:   image.Config{Width: 4, Height: 4},
+	}
+
+	frames := GIFFrames(g)
+	if !assert.Len(t, frames, 4) {
+		return
+	}
+	want := []struct{ topLeft, bottomRight color.Color }{
+		{red, red},
+		{blue, red},
+		// The second frame is disposed to the background.
+		{color.RGBA{}, green},
+		// The third frame is disposed to the previous frame.
+		{color.RGBA{}, red},
+	}
+	for i, w := range want {
+		assert.Equal(t, image.Rect(0, 0, 4, 4), frames[i].Bounds())
+		assert.Equal(t, w.topLeft, frames[i].At(0, 0), "frame %d", i)
+		assert.Equal(t, w.bottomRight, frames[i].At(3, 3), "frame %d", i)
+	}
+	assert.Equal(t, blue, frames[3].At(0, 3))
+}
+
+func TestTileGIF(t *testing.T) {
+	t.Parallel()
+
+	red := color.RGBA{255, 0, 0, 255}
+	darkRed := color.RGBA{191, 0, 0, 255}
+	g := &gif.GIF{
+		Image: []*image.Paletted{
+			image.NewPaletted(image.Rect(0, 0, 4, 4), color.Palette{red}),
+			image.NewPaletted(image.Rect(0, 0, 4, 4), color.Palette{darkRed}),
+		},
+		Delay:     []int{10, 20},
+		LoopCount: 3,
+		Config:    image.Config{Width: 4, Height: 4},
+	}
+	tiles := []image.Image{
+		uniform(image.Rect(0, 0, 4, 4), red),
+		uniform(image.Rect(0, 0, 4, 4), darkRed),
+	}
+
+	tests := []struct {
+		stability float64
+		want      color.Color
+	}{
+		// The closest tile is placed on the second frame.
+		{stability: 0, want: darkRed},
+		// The tile of the first frame is kept.
+		{stability: 1, want: red},
+	}
+
+	for _, tt := range tests {
+		out, err := TileGIF(context.Background(), g, tiles, Config{FrameStability: tt.stability}, nil)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		assert.Equal(t, []int{10, 20}, out.Delay)
+		assert.Equal(t, 3, out.LoopCount)
+		if assert.Len(t, out.Image, 2) {
+			assert.Equal(t, red, color.RGBAModel.Convert(out.Image[0].At(0, 0)))
+			assert.Equal(t, tt.want, color.RGBAModel.Convert(out.Image[1].At(0, 0)), "stability %v", tt.stability)
+		}
+	}
+
+	_, err := TileGIF(context.Background(), &gif.GIF{}, tiles, Config{}, nil)
+	assert.Equal(t, ErrEmptyImage, err)
+}
+
+func TestTileGIFCache(t *testing.T) {
+	t.Parallel()
+
+	red := color.RGBA{255, 0, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+	g := &gif.GIF{Config: image.Config{Width: 8, Height: 8}}
+	for i := 0; i < 6; i++ {
+		c := red
+		if i%2 == 1 {
+			c = blue
+		}
+		g.Image = append(g.Image, image.NewPaletted(image.Rect(0, 0, 8, 8), color.Palette{c}))
+	}
+	tiles := []image.Image{
+		uniform(image.Rect(0, 0, 4, 4), red),
+		uniform(image.Rect(0, 0, 4, 4), blue),
+	}
+	cfg := Config{Logf: func(string, ...interface{}) {}}
+	cfg.TilesPermute.MemoryBudget = 1 << 20
+	frames := GIFFrames(g)
+
+	tl, err := newTiling(context.Background(), frames[0], tiles, cfg)
+	if !assert.NoError(t, err) {
+		return
+	}
+	reserved := tl.cache.Reserved()
+	var peak int64
+	update := func(image.Image) {
+		if r := tl.cache.Reserved(); r > peak {
+			peak = r
+		}
+	}
+
+	// The bytes that are reserved while tiling a frame don't grow with the number of frames.
+	_, err = tl.tileGIF(context.Background(), g, frames[:1], update)
+	assert.NoError(t, err)
+	framePeak := peak
+	assert.True(t, framePeak > reserved)
+
+	_, err = tl.tileGIF(context.Background(), g, frames, update)
+	assert.NoError(t, err)
+	assert.Equal(t, framePeak, peak)
+	assert.Equal(t, reserved, tl.cache.Reserved())
+}
@@ -0,0 +1,58 @@
+package tiler
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// Glyphs rasterizes characters of a font face into tiles, to be used for tiling text art. All the
+// tiles are in the same size, which fits the widest character and the ascent and descent of the
+// face, and each character is centered horizontally. The characters are drawn in the foreground
+// color over the background color. Duplicate characters and characters that the face reports no
+// glyph for are skipped. It returns the tiles and their characters, in the same order.
+func Glyphs(face font.Face, runes []rune, fg, bg color.Color) ([]image.Image, []rune) {
+	var (
+		advances = make(map[rune]fixed.Int26_6)
+		kept     []rune
+		width    fixed.Int26_6
+	)
+	for _, r := range runes {
+		advance, ok := face.GlyphAdvance(r)
+		if !ok {
+			continue
+		}
+		if _, seen := advances[r]; seen {
+			continue
+		}
+		advances[r] = advance
+		kept = append(kept, r)
+		if advance > width {
+			width = advance
+		}
+	}
+
+	metrics := face.Metrics()
+	size := image.Pt(width.Ceil(), metrics.Ascent.Ceil()+metrics.Descent.Ceil())
+	if size.X <= 0 || size.Y <= 0 {
+		return nil, nil
+	}
+
+	tiles := make([]image.Image, 0, len(kept))
+	for _, r := range kept {
+		tile := image.NewRGBA(image.Rectangle{Max: size})
+		draw.Draw(tile, tile.Rect, image.NewUniform(bg), image.ZP, draw.Src)
+		d := font.Drawer{
+			Dst:  tile,
+			Src:  image.NewUniform(fg),
+			Face: face,
+			Dot:  fixed.Point26_6{X: (width - advances[r]) / 2, Y: fixed.I(metrics.Ascent.Ceil())},
+		}
+		d.DrawString(string(r))
+		tiles = append(tiles, tile)
+	}
+	return tiles, kept
+}
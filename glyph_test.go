@@ -0,0 +1,73 @@
+package tiler
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"sort"
+	"testing"
+
+	"github.com/posener/tiler/internal/imglib"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/image/font/basicfont"
+)
+
+func TestGlyphs(t *testing.T) {
+	t.Parallel()
+
+	face := basicfont.Face7x13
+	tiles, runes := Glyphs(face, []rune(" #.#"), color.White, color.Black)
+
+	// Duplicate characters are skipped.
+	assert.Equal(t, []rune(" #."), runes)
+	if !assert.Len(t, tiles, 3) {
+		return
+	}
+	for _, tile := range tiles {
+		assert.Equal(t, image.Rect(0, 0, 7, 13), tile.Bounds())
+	}
+	assert.InDelta(t, 0, ink(tiles[0]), 1e-9)
+	assert.True(t, ink(tiles[1]) > ink(tiles[2]))
+
+	tiles, runes = Glyphs(face, nil, color.White, color.Black)
+	assert.Empty(t, tiles)
+	assert.Empty(t, runes)
+}
+
+// ink returns the fraction of the non-black pixels in the image.
+func ink(img image.Image) float64 {
+	var n int
+	for y := img.Bounds().Min.Y; y < img.Bounds().Max.Y; y++ {
+		for x := img.Bounds().Min.X; x < img.Bounds().Max.X; x++ {
+			if r, g, b, _ := img.At(x, y).RGBA(); r+g+b > 0 {
+				n++
+			}
+		}
+	}
+	return float64(n) / float64(imglib.Area(img.Bounds()))
+}
+
+func TestTilePlaced(t *testing.T) {
+	t.Parallel()
+
+	red := color.RGBA{255, 0, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+	img := uniform(image.Rect(0, 0, 8, 4), red)
+	draw.Draw(img, image.Rect(4, 0, 8, 4), image.NewUniform(blue), image.ZP, draw.Src)
+	tiles := []image.Image{
+		uniform(image.Rect(0, 0, 4, 4), blue),
+		uniform(image.Rect(0, 0, 4, 4), red),
+	}
+
+	var placed []Placement
+	cfg := Config{Placed: func(p Placement) { placed = append(placed, p) }}
+	_, err := TileContext(context.Background(), img, tiles, cfg, nil)
+	assert.NoError(t, err)
+
+	sort.Slice(placed, func(i, j int) bool { return placed[i].Rect.Min.X < placed[j].Rect.Min.X })
+	assert.Equal(t, []Placement{
+		{Source: 1, Rect: image.Rect(0, 0, 4, 4), Color: red},
+		{Source: 0, Rect: image.Rect(4, 0, 8, 4), Color: blue},
+	}, placed)
+}
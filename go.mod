@@ -3,7 +3,7 @@ module github.com/posener/tiler
 go 1.13
 
 require (
-	github.com/BurntSushi/graphics-go v0.0.0-20160129215708-b43f31a4a966
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/stretchr/testify v1.4.0
+	golang.org/x/image v0.0.0-20200927104501-e162460cd6b5
 )
@@ -2,22 +2,28 @@ package clrlib
 
 import (
 	"image/color"
+	"math"
 )
 
-const maxDist float64 = 255 * 255 * 3
+// DistanceFunc returns the distance between two colors in range [0..1].
+type DistanceFunc func(c1, c2 color.Color) float64
+
+// Maximal distances between two colors in the sRGB gamut, used to normalize the distances to the
+// [0..1] range.
+const (
+	maxDist          float64 = 255 * 255 * 3
+	maxDistCIE76     float64 = 259
+	maxDistCIE94     float64 = 150
+	maxDistCIEDE2000 float64 = 120
+)
 
 // Distance betwen two colors [0..1]
 func Distance(c1, c2 color.Color) float64 {
 	rgb1 := RGBA(c1)
 	rgb2 := RGBA(c2)
 
-	// Distance according to alpha: if both are transparent, they are the same. If only one of them
-	// is transparent, they don't match.
-	if rgb1.A == 0 && rgb2.A == 0 {
-		return 0
-	}
-	if rgb1.A == 0 || rgb2.A == 0 {
-		return 1
+	if d, ok := alphaDistance(rgb1, rgb2); ok {
+		return d
 	}
 
 	// Distance according to color components.
@@ -26,3 +32,130 @@ func Distance(c1, c2 color.Color) float64 {
 	db := float64(rgb1.B) - float64(rgb2.B)
 	return (dr*dr + dg*dg + db*db) / maxDist
 }
+
+// CIE76 is the euclidean distance between two colors in the CIELAB color space [0..1].
+func CIE76(c1, c2 color.Color) float64 {
+	if d, ok := alphaDistance(RGBA(c1), RGBA(c2)); ok {
+		return d
+	}
+	lab1, lab2 := ToLab(c1), ToLab(c2)
+	dl := lab1.L - lab2.L
+	da := lab1.A - lab2.A
+	db := lab1.B - lab2.B
+	return normalize(math.Sqrt(dl*dl+da*da+db*db), maxDistCIE76)
+}
+
+// CIE94 is the CIE 1994 color difference between two colors, with graphic arts weights [0..1].
+func CIE94(c1, c2 color.Color) float64 {
+	if d, ok := alphaDistance(RGBA(c1), RGBA(c2)); ok {
+		return d
+	}
+	const (
+		k1 = 0.045
+		k2 = 0.015
+	)
+	lab1, lab2 := ToLab(c1), ToLab(c2)
+	dl := lab1.L - lab2.L
+	c1ab := math.Hypot(lab1.A, lab1.B)
+	c2ab := math.Hypot(lab2.A, lab2.B)
+	dc := c1ab - c2ab
+	da := lab1.A - lab2.A
+	db := lab1.B - lab2.B
+	// dh is the hue difference, which can get slightly negative due to floating point errors.
+	dh := math.Sqrt(math.Max(0, da*da+db*db-dc*dc))
+
+	sc := 1 + k1*c1ab
+	sh := 1 + k2*c1ab
+	dc, dh = dc/sc, dh/sh
+	return normalize(math.Sqrt(dl*dl+dc*dc+dh*dh), maxDistCIE94)
+}
+
+// CIEDE2000 is the CIE 2000 color difference between two colors [0..1].
+func CIEDE2000(c1, c2 color.Color) float64 {
+	if d, ok := alphaDistance(RGBA(c1), RGBA(c2)); ok {
+		return d
+	}
+	lab1, lab2 := ToLab(c1), ToLab(c2)
+
+	cBar := (math.Hypot(lab1.A, lab1.B) + math.Hypot(lab2.A, lab2.B)) / 2
+	cBar7 := math.Pow(cBar, 7)
+	g := 0.5 * (1 - math.Sqrt(cBar7/(cBar7+math.Pow(25, 7))))
+	a1, a2 := (1+g)*lab1.A, (1+g)*lab2.A
+	cp1, cp2 := math.Hypot(a1, lab1.B), math.Hypot(a2, lab2.B)
+	hp1, hp2 := hueAngle(lab1.B, a1), hueAngle(lab2.B, a2)
+
+	dl := lab2.L - lab1.L
+	dc := cp2 - cp1
+	var dhp float64
+	if cp1*cp2 != 0 {
+		dhp = hp2 - hp1
+		switch {
+		case dhp > 180:
+			dhp -= 360
+		case dhp < -180:
+			dhp += 360
+		}
+	}
+	dh := 2 * math.Sqrt(cp1*cp2) * math.Sin(rad(dhp/2))
+
+	lBar := (lab1.L + lab2.L) / 2
+	cpBar := (cp1 + cp2) / 2
+	hpBar := hp1 + hp2
+	if cp1*cp2 != 0 {
+		switch {
+		case math.Abs(hp1-hp2) <= 180:
+			hpBar /= 2
+		case hp1+hp2 < 360:
+			hpBar = (hpBar + 360) / 2
+		default:
+			hpBar = (hpBar - 360) / 2
+		}
+	}
+
+	t := 1 - 0.17*math.Cos(rad(hpBar-30)) + 0.24*math.Cos(rad(2*hpBar)) +
+		0.32*math.Cos(rad(3*hpBar+6)) - 0.20*math.Cos(rad(4*hpBar-63))
+	dTheta := 30 * math.Exp(-math.Pow((hpBar-275)/25, 2))
+	cpBar7 := math.Pow(cpBar, 7)
+	rc := 2 * math.Sqrt(cpBar7/(cpBar7+math.Pow(25, 7)))
+	l50 := (lBar - 50) * (lBar - 50)
+	sl := 1 + 0.015*l50/math.Sqrt(20+l50)
+	sc := 1 + 0.045*cpBar
+	sh := 1 + 0.015*cpBar*t
+	rt := -math.Sin(rad(2*dTheta)) * rc
+
+	dl, dc, dh = dl/sl, dc/sc, dh/sh
+	return normalize(math.Sqrt(dl*dl+dc*dc+dh*dh+rt*dc*dh), maxDistCIEDE2000)
+}
+
+// alphaDistance returns the distance according to alpha: if both are transparent, they are the
+// same. If only one of them is transparent, they don't match. The returned bool is false if the
+// distance should be computed from the color components.
+func alphaDistance(rgb1, rgb2 color.RGBA) (float64, bool) {
+	if rgb1.A == 0 && rgb2.A == 0 {
+		return 0, true
+	}
+	if rgb1.A == 0 || rgb2.A == 0 {
+		return 1, true
+	}
+	return 0, false
+}
+
+func normalize(d, max float64) float64 {
+	return math.Min(d/max, 1)
+}
+
+// hueAngle returns the angle of the given color components in degrees [0..360).
+func hueAngle(b, a float64) float64 {
+	if a == 0 && b == 0 {
+		return 0
+	}
+	h := math.Atan2(b, a) * 180 / math.Pi
+	if h < 0 {
+		h += 360
+	}
+	return h
+}
+
+func rad(deg float64) float64 {
+	return deg * math.Pi / 180
+}
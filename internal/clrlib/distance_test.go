@@ -25,3 +25,33 @@ func TestDistance(t *testing.T) {
 		assert.Equal(t, tt.want, Distance(tt.c1, tt.c2), "Distance(%+v, %+v)", tt.c1, tt.c2)
 	}
 }
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+
+	metrics := map[string]DistanceFunc{
+		"rgb":       Distance,
+		"cie76":     CIE76,
+		"cie94":     CIE94,
+		"ciede2000": CIEDE2000,
+	}
+	transparent := color.RGBA{255, 255, 255, 0}
+
+	for name, metric := range metrics {
+		assert.Equal(t, 0.0, metric(color.White, color.White), name)
+		assert.Equal(t, 0.0, metric(transparent, color.Transparent), name)
+		assert.Equal(t, 1.0, metric(color.Black, transparent), name)
+
+		d := metric(color.White, color.Black)
+		assert.True(t, d > 0.3 && d <= 1, "%s: white-black distance %f", name, d)
+	}
+}
+
+func TestCIEDE2000(t *testing.T) {
+	t.Parallel()
+
+	red := color.RGBA{255, 0, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+	assert.InDelta(t, 52.88/maxDistCIEDE2000, CIEDE2000(red, blue), 0.001)
+	assert.InDelta(t, CIEDE2000(red, blue), CIEDE2000(blue, red), 1e-9)
+}
@@ -0,0 +1,126 @@
+package clrlib
+
+import (
+	"image/color"
+	"math"
+)
+
+// Hue is a color model that rotates the hue of colors in the HSV color space. The rotation is in
+// range [0..1], where 1 is a full rotation.
+type Hue float64
+
+func (h Hue) Convert(c color.Color) color.Color {
+	return adjustHSV(c, func(hue, s, v float64) (float64, float64, float64) {
+		hue = math.Mod(hue+float64(h), 1)
+		if hue < 0 {
+			hue++
+		}
+		return hue, s, v
+	})
+}
+
+// Saturation is a color model that multiplies the saturation of colors in the HSV color space by
+// a factor. The result is clamped.
+type Saturation float64
+
+func (f Saturation) Convert(c color.Color) color.Color {
+	return adjustHSV(c, func(h, s, v float64) (float64, float64, float64) {
+		return h, clamp(s * float64(f)), v
+	})
+}
+
+// Brightness is a color model that multiplies the value of colors in the HSV color space by a
+// factor. Factors above 1 brighten the colors. The result is clamped.
+type Brightness float64
+
+func (f Brightness) Convert(c color.Color) color.Color {
+	return adjustHSV(c, func(h, s, v float64) (float64, float64, float64) {
+		return h, s, clamp(v * float64(f))
+	})
+}
+
+// Gamma is a color model that applies a gamma correction to colors. Values above 1 brighten the
+// colors and values below 1 darken them.
+type Gamma float64
+
+func (g Gamma) Convert(c color.Color) color.Color {
+	nrgba := color.NRGBAModel.Convert(c).(color.NRGBA)
+	correct := func(v uint8) uint8 {
+		return uint8(math.Round(255 * math.Pow(float64(v)/255, 1/float64(g))))
+	}
+	nrgba.R, nrgba.G, nrgba.B = correct(nrgba.R), correct(nrgba.G), correct(nrgba.B)
+	return nrgba
+}
+
+// Chain is a color model that applies a list of models, one after the other.
+type Chain []color.Model
+
+func (ch Chain) Convert(c color.Color) color.Color {
+	for _, m := range ch {
+		c = m.Convert(c)
+	}
+	return c
+}
+
+// adjustHSV converts a color to the HSV color space, in which all values are in range [0..1],
+// adjusts it with the given function and converts it back.
+func adjustHSV(c color.Color, adjust func(h, s, v float64) (float64, float64, float64)) color.Color {
+	nrgba := color.NRGBAModel.Convert(c).(color.NRGBA)
+	h, s, v := toHSV(nrgba)
+	h, s, v = adjust(h, s, v)
+	r, g, b := fromHSV(h, s, v)
+	return color.NRGBA{R: r, G: g, B: b, A: nrgba.A}
+}
+
+func toHSV(c color.NRGBA) (h, s, v float64) {
+	r, g, b := float64(c.R)/255, float64(c.G)/255, float64(c.B)/255
+	max := math.Max(r, math.Max(g, b))
+	min := math.Min(r, math.Min(g, b))
+	d := max - min
+	v = max
+	if max > 0 {
+		s = d / max
+	}
+	if d == 0 {
+		return 0, s, v
+	}
+	switch max {
+	case r:
+		h = (g - b) / d
+		if h < 0 {
+			h += 6
+		}
+	case g:
+		h = (b-r)/d + 2
+	default:
+		h = (r-g)/d + 4
+	}
+	return h / 6, s, v
+}
+
+func fromHSV(h, s, v float64) (r, g, b uint8) {
+	h = 6 * h
+	i := math.Floor(h)
+	f := h - i
+	p, q, t := v*(1-s), v*(1-s*f), v*(1-s*(1-f))
+	var rf, gf, bf float64
+	switch int(i) % 6 {
+	case 0:
+		rf, gf, bf = v, t, p
+	case 1:
+		rf, gf, bf = q, v, p
+	case 2:
+		rf, gf, bf = p, v, t
+	case 3:
+		rf, gf, bf = p, q, v
+	case 4:
+		rf, gf, bf = t, p, v
+	default:
+		rf, gf, bf = v, p, q
+	}
+	return uint8(math.Round(rf * 255)), uint8(math.Round(gf * 255)), uint8(math.Round(bf * 255))
+}
+
+func clamp(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
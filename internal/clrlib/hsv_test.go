@@ -0,0 +1,38 @@
+package clrlib
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHSVModels(t *testing.T) {
+	t.Parallel()
+
+	red := color.NRGBA{255, 0, 0, 255}
+	darkRed := color.NRGBA{128, 0, 0, 255}
+
+	tests := []struct {
+		model   color.Model
+		c, want color.Color
+	}{
+		{model: Hue(0), c: red, want: red},
+		{model: Hue(1.0 / 3), c: red, want: color.NRGBA{0, 255, 0, 255}},
+		{model: Hue(2.0 / 3), c: red, want: color.NRGBA{0, 0, 255, 255}},
+		{model: Hue(-1.0 / 3), c: red, want: color.NRGBA{0, 0, 255, 255}},
+		{model: Saturation(0), c: red, want: color.NRGBA{255, 255, 255, 255}},
+		{model: Saturation(0.5), c: red, want: color.NRGBA{255, 128, 128, 255}},
+		{model: Brightness(2), c: darkRed, want: red},
+		{model: Brightness(0.5), c: red, want: darkRed},
+		{model: Gamma(1), c: darkRed, want: darkRed},
+		{model: Gamma(2), c: color.NRGBA{64, 0, 255, 255}, want: color.NRGBA{128, 0, 255, 255}},
+		{model: Chain{Hue(1.0 / 3), Brightness(0.5)}, c: red, want: color.NRGBA{0, 128, 0, 255}},
+		// Alpha is preserved.
+		{model: Hue(1.0 / 3), c: color.NRGBA{255, 0, 0, 128}, want: color.NRGBA{0, 255, 0, 128}},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.model.Convert(tt.c), "%T(%v)", tt.model, tt.model)
+	}
+}
@@ -0,0 +1,52 @@
+package clrlib
+
+import (
+	"image/color"
+	"math"
+)
+
+// Lab is a color in the CIELAB color space, with the D65 white point.
+type Lab struct {
+	L, A, B float64
+}
+
+// D65 reference white point.
+const (
+	whiteX = 0.95047
+	whiteY = 1.00000
+	whiteZ = 1.08883
+)
+
+// ToLab converts a color to the CIELAB color space. The alpha channel is ignored.
+func ToLab(c color.Color) Lab {
+	rgba := RGBA(c)
+	r, g, b := linear(rgba.R), linear(rgba.G), linear(rgba.B)
+
+	x := (0.4124564*r + 0.3575761*g + 0.1804375*b) / whiteX
+	y := (0.2126729*r + 0.7151522*g + 0.0721750*b) / whiteY
+	z := (0.0193339*r + 0.1191920*g + 0.9503041*b) / whiteZ
+
+	fx, fy, fz := labF(x), labF(y), labF(z)
+	return Lab{
+		L: 116*fy - 16,
+		A: 500 * (fx - fy),
+		B: 200 * (fy - fz),
+	}
+}
+
+// linear converts an sRGB component to linear RGB in range [0..1].
+func linear(c uint8) float64 {
+	v := float64(c) / 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func labF(t float64) float64 {
+	const delta = 6.0 / 29
+	if t > delta*delta*delta {
+		return math.Cbrt(t)
+	}
+	return t/(3*delta*delta) + 4.0/29
+}
@@ -0,0 +1,29 @@
+package clrlib
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToLab(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		c    color.Color
+		want Lab
+	}{
+		{c: color.White, want: Lab{L: 100}},
+		{c: color.Black, want: Lab{}},
+		{c: color.RGBA{255, 0, 0, 255}, want: Lab{L: 53.24, A: 80.09, B: 67.2}},
+		{c: color.RGBA{0, 0, 255, 255}, want: Lab{L: 32.3, A: 79.19, B: -107.86}},
+	}
+
+	for _, tt := range tests {
+		got := ToLab(tt.c)
+		assert.InDelta(t, tt.want.L, got.L, 0.01, "L of %+v", tt.c)
+		assert.InDelta(t, tt.want.A, got.A, 0.01, "A of %+v", tt.c)
+		assert.InDelta(t, tt.want.B, got.B, 0.01, "B of %+v", tt.c)
+	}
+}
@@ -40,3 +40,38 @@ func (s Scaled) Convert(c color.Color) color.Color {
 func scale(c uint8, s float64) uint8 {
 	return uint8(float64(c) * s)
 }
+
+// Shift is a color model that adds a value to every color component, in range [-255..255]. The
+// values are added to the non alpha-premultiplied components, and are clamped.
+type Shift struct {
+	R, G, B float64
+}
+
+// NewShift returns a shift from one color towards another color, by an amount in range [0..1].
+// A shift with amount of 1 converts the from color to the to color.
+func NewShift(from, to color.Color, amount float64) Shift {
+	f, t := color.NRGBAModel.Convert(from).(color.NRGBA), color.NRGBAModel.Convert(to).(color.NRGBA)
+	return Shift{
+		R: amount * (float64(t.R) - float64(f.R)),
+		G: amount * (float64(t.G) - float64(f.G)),
+		B: amount * (float64(t.B) - float64(f.B)),
+	}
+}
+
+func (s Shift) Convert(c color.Color) color.Color {
+	nrgba := color.NRGBAModel.Convert(c).(color.NRGBA)
+	nrgba.R = shift(nrgba.R, s.R)
+	nrgba.G = shift(nrgba.G, s.G)
+	nrgba.B = shift(nrgba.B, s.B)
+	return nrgba
+}
+
+func shift(c uint8, s float64) uint8 {
+	return uint8(math.Max(0, math.Min(255, math.Round(float64(c)+s))))
+}
+
+// Luminance returns the relative luminance of a color in range [0..255].
+func Luminance(c color.Color) float64 {
+	rgba := RGBA(c)
+	return 0.2126*float64(rgba.R) + 0.7152*float64(rgba.G) + 0.0722*float64(rgba.B)
+}
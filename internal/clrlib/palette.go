@@ -0,0 +1,129 @@
+package clrlib
+
+import (
+	"image/color"
+	"sort"
+)
+
+// MedianCut returns a palette of at most n colors that represents the given color histogram,
+// using the median cut algorithm. The palette colors are the weighted means of the colors in
+// each box.
+func MedianCut(hist map[color.RGBA]int, n int) []color.Color {
+	if n <= 0 || len(hist) == 0 {
+		return nil
+	}
+	all := make(box, 0, len(hist))
+	for c, count := range hist {
+		all = append(all, weighted{c: c, count: count})
+	}
+	// Sort for a deterministic result.
+	sort.Slice(all, func(i, j int) bool { return less(all[i].c, all[j].c) })
+
+	boxes := []box{all}
+	for len(boxes) < n {
+		// Split the box with the widest range of a color component.
+		i, ch := -1, 0
+		widest := uint8(0)
+		for j, b := range boxes {
+			if len(b) < 2 {
+				continue
+			}
+			if c, r := b.widest(); r >= widest {
+				i, ch, widest = j, c, r
+			}
+		}
+		if i < 0 {
+			break
+		}
+		left, right := boxes[i].split(ch)
+		boxes[i] = left
+		boxes = append(boxes, right)
+	}
+
+	palette := make([]color.Color, 0, len(boxes))
+	for _, b := range boxes {
+		palette = append(palette, b.mean())
+	}
+	return palette
+}
+
+type weighted struct {
+	c     color.RGBA
+	count int
+}
+
+type box []weighted
+
+func component(c color.RGBA, ch int) uint8 {
+	switch ch {
+	case 0:
+		return c.R
+	case 1:
+		return c.G
+	default:
+		return c.B
+	}
+}
+
+// widest returns the color component with the widest range in the box, and its range.
+func (b box) widest() (int, uint8) {
+	ch, widest := 0, uint8(0)
+	for c := 0; c < 3; c++ {
+		min, max := uint8(255), uint8(0)
+		for _, w := range b {
+			v := component(w.c, c)
+			if v < min {
+				min = v
+			}
+			if v > max {
+				max = v
+			}
+		}
+		if max-min > widest {
+			ch, widest = c, max-min
+		}
+	}
+	return ch, widest
+}
+
+// split splits the box by the weighted median of the given color component.
+func (b box) split(ch int) (box, box) {
+	sort.SliceStable(b, func(i, j int) bool { return component(b[i].c, ch) < component(b[j].c, ch) })
+	total := 0
+	for _, w := range b {
+		total += w.count
+	}
+	sum, i := 0, 0
+	for ; i < len(b)-2; i++ {
+		sum += b[i].count
+		if 2*sum >= total {
+			break
+		}
+	}
+	return b[:i+1], b[i+1:]
+}
+
+func (b box) mean() color.Color {
+	var r, g, bl, a, total int
+	for _, w := range b {
+		r += int(w.c.R) * w.count
+		g += int(w.c.G) * w.count
+		bl += int(w.c.B) * w.count
+		a += int(w.c.A) * w.count
+		total += w.count
+	}
+	return color.RGBA{R: uint8(r / total), G: uint8(g / total), B: uint8(bl / total), A: uint8(a / total)}
+}
+
+func less(c1, c2 color.RGBA) bool {
+	if c1.R != c2.R {
+		return c1.R < c2.R
+	}
+	if c1.G != c2.G {
+		return c1.G < c2.G
+	}
+	if c1.B != c2.B {
+		return c1.B < c2.B
+	}
+	return c1.A < c2.A
+}
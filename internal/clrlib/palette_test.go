@@ -0,0 +1,38 @@
+package clrlib
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMedianCut(t *testing.T) {
+	t.Parallel()
+
+	hist := map[color.RGBA]int{
+		{255, 0, 0, 255}:   10,
+		{250, 0, 0, 255}:   10,
+		{0, 0, 255, 255}:   5,
+		{0, 10, 245, 255}:  5,
+		{0, 255, 0, 255}:   1,
+		{10, 250, 0, 255}:  1,
+		{128, 128, 0, 255}: 1,
+	}
+
+	assert.Nil(t, MedianCut(hist, 0))
+	// A single color palette is the weighted mean color.
+	assert.Equal(t, []color.Color{color.RGBA{157, 20, 75, 255}}, MedianCut(hist, 1))
+	assert.Len(t, MedianCut(hist, 3), 3)
+
+	// A palette can't be larger than the number of colors.
+	var all []color.Color
+	for c := range hist {
+		all = append(all, c)
+	}
+	assert.ElementsMatch(t, all, MedianCut(hist, 100))
+
+	// Boxes are split even when the median is the last color.
+	skewed := map[color.RGBA]int{{0, 0, 0, 255}: 1, {255, 255, 255, 255}: 100}
+	assert.Len(t, MedianCut(skewed, 2), 2)
+}
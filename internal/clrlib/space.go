@@ -0,0 +1,34 @@
+package clrlib
+
+import (
+	"image/color"
+	"math"
+)
+
+// Space is a color space in which a color distance function can be bounded by the euclidean
+// distance between colors coordinates. It enables spatial indexing of colors.
+type Space struct {
+	// Coords returns the coordinates of a color in the space.
+	Coords func(c color.Color) [3]float64
+	// Bound returns a lower bound of the color distance between two colors, given the squared
+	// euclidean distance between their coordinates.
+	Bound func(sq float64) float64
+}
+
+// RGBSpace is the space of the Distance function.
+var RGBSpace = Space{
+	Coords: func(c color.Color) [3]float64 {
+		rgba := RGBA(c)
+		return [3]float64{float64(rgba.R), float64(rgba.G), float64(rgba.B)}
+	},
+	Bound: func(sq float64) float64 { return sq / maxDist },
+}
+
+// LabSpace is the space of the CIE76 distance function.
+var LabSpace = Space{
+	Coords: func(c color.Color) [3]float64 {
+		lab := ToLab(c)
+		return [3]float64{lab.L, lab.A, lab.B}
+	},
+	Bound: func(sq float64) float64 { return normalize(math.Sqrt(sq), maxDistCIE76) },
+}
@@ -0,0 +1,196 @@
+package imglib
+
+import (
+	"image"
+	"math/bits"
+)
+
+// Bitmap is a set of pixels in a rectangle, packed in 64 bit words. Each row of the rectangle
+// starts in a new word.
+type Bitmap struct {
+	Rect   image.Rectangle
+	stride int
+	words  []uint64
+}
+
+// NewBitmap returns an empty bitmap of the given rectangle.
+func NewBitmap(rect image.Rectangle) *Bitmap {
+	stride := (rect.Dx() + 63) / 64
+	return &Bitmap{Rect: rect, stride: stride, words: make([]uint64, stride*rect.Dy())}
+}
+
+// Opaque returns a bitmap of the pixels of the given image that are not completely transparent.
+func Opaque(img image.Image) *Bitmap {
+	img = Render(img)
+	rect := img.Bounds()
+	b := NewBitmap(rect)
+	switch img := img.(type) {
+	case *image.RGBA:
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				if img.Pix[img.PixOffset(x, y)+3] > 0 {
+					b.Set(x, y)
+				}
+			}
+		}
+	default:
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				if _, _, _, a := img.At(x, y).RGBA(); a > 0 {
+					b.Set(x, y)
+				}
+			}
+		}
+	}
+	return b
+}
+
+// Get returns whether a pixel is set.
+func (b *Bitmap) Get(x, y int) bool {
+	if !image.Pt(x, y).In(b.Rect) {
+		return false
+	}
+	i, bit := b.index(x, y)
+	return b.words[i]&(1<<bit) != 0
+}
+
+// Set sets a pixel. Pixels outside the bitmap rectangle are ignored.
+func (b *Bitmap) Set(x, y int) {
+	if !image.Pt(x, y).In(b.Rect) {
+		return
+	}
+	i, bit := b.index(x, y)
+	b.words[i] |= 1 << bit
+}
+
+// Count returns the number of set pixels.
+func (b *Bitmap) Count() int {
+	n := 0
+	for _, w := range b.words {
+		n += bits.OnesCount64(w)
+	}
+	return n
+}
+
+// Bytes returns the number of bytes of the pixels of the bitmap.
+func (b *Bitmap) Bytes() int64 {
+	return int64(8 * len(b.words))
+}
+
+// Intersects returns whether any pixel that is set in other, when translated by the given offset,
+// is also set in b.
+func (b *Bitmap) Intersects(other *Bitmap, offset image.Point) bool {
+	intersects := false
+	b.each(other, offset, func(i int, w uint64) bool {
+		intersects = b.words[i]&w != 0
+		return !intersects
+	})
+	return intersects
+}
+
+// Or sets all the pixels that are set in other, when translated by the given offset.
+func (b *Bitmap) Or(other *Bitmap, offset image.Point) {
+	b.each(other, offset, func(i int, w uint64) bool {
+		b.words[i] |= w
+		return true
+	})
+}
+
+// each calls fn with the words of other, when translated by the given offset and aligned to the
+// words of b. It stops if fn returns false.
+func (b *Bitmap) each(other *Bitmap, offset image.Point, fn func(i int, w uint64) bool) {
+	// The x position of the first pixel of other rows, relative to b rows.
+	dx := other.Rect.Min.X + offset.X - b.Rect.Min.X
+	// The mask of the valid pixels in the last word of b rows.
+	last := ^uint64(0)
+	if r := b.Rect.Dx() % 64; r > 0 {
+		last = 1<<uint(r) - 1
+	}
+
+	for oy := 0; oy < other.Rect.Dy(); oy++ {
+		y := other.Rect.Min.Y + offset.Y + oy - b.Rect.Min.Y
+		if y < 0 || y >= b.Rect.Dy() {
+			continue
+		}
+		for k, w := range other.words[oy*other.stride : (oy+1)*other.stride] {
+			if w == 0 {
+				continue
+			}
+			// Split the word between the two words of b that it overlaps.
+			s := dx + 64*k
+			q, r := floorDiv(s, 64), uint(mod(s, 64))
+			parts := [2]uint64{w << r, 0}
+			if r > 0 {
+				parts[1] = w >> (64 - r)
+			}
+			for j, part := range parts {
+				i := q + j
+				if part == 0 || i < 0 || i >= b.stride {
+					continue
+				}
+				if i == b.stride-1 {
+					part &= last
+				}
+				if part != 0 && !fn(y*b.stride+i, part) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func (b *Bitmap) index(x, y int) (int, uint) {
+	x, y = x-b.Rect.Min.X, y-b.Rect.Min.Y
+	return y*b.stride + x/64, uint(x % 64)
+}
+
+func floorDiv(a, b int) int {
+	q := a / b
+	if a%b != 0 && a < 0 {
+		q--
+	}
+	return q
+}
+
+func mod(a, b int) int {
+	m := a % b
+	if m < 0 {
+		m += b
+	}
+	return m
+}
+
+// CountAnd returns the number of pixels that are set both in b and in other, which must have the
+// same rectangle as b.
+func (b *Bitmap) CountAnd(other *Bitmap) int {
+	if b.Rect != other.Rect {
+		panic("bitmaps rectangles mismatch")
+	}
+	n := 0
+	for i, w := range b.words {
+		n += bits.OnesCount64(w & other.words[i])
+	}
+	return n
+}
+
+// Filled returns a bitmap of the given rectangle in which all the pixels are set.
+func Filled(rect image.Rectangle) *Bitmap {
+	b := NewBitmap(rect)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			b.Set(x, y)
+		}
+	}
+	return b
+}
+
+// AndNot unsets all the pixels in b that are set in other, which must have the same rectangle as
+// b.
+func (b *Bitmap) AndNot(other *Bitmap) {
+	if b.Rect != other.Rect {
+		panic("bitmaps rectangles mismatch")
+	}
+	for i, w := range other.words {
+		b.words[i] &^= w
+	}
+}
@@ -0,0 +1,69 @@
+package imglib
+
+import (
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBitmap(t *testing.T) {
+	t.Parallel()
+
+	rnd := rand.New(rand.NewSource(1))
+	randImage := func(rect image.Rectangle, density float64) *image.RGBA {
+		img := image.NewRGBA(rect)
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				if rnd.Float64() < density {
+					img.Set(x, y, color.Black)
+				}
+			}
+		}
+		return img
+	}
+
+	for i := 0; i < 200; i++ {
+		dst := randImage(image.Rect(-3, 5, 60+rnd.Intn(100), 40), 0.02)
+		src := randImage(image.Rect(0, 0, 1+rnd.Intn(130), 1+rnd.Intn(20)), 0.05)
+		offset := image.Pt(rnd.Intn(200)-70, rnd.Intn(50))
+
+		b := Opaque(dst)
+		other := Opaque(src)
+
+		// Compare with a pixel by pixel intersection.
+		var want bool
+		for y := src.Rect.Min.Y; y < src.Rect.Max.Y; y++ {
+			for x := src.Rect.Min.X; x < src.Rect.Max.X; x++ {
+				if other.Get(x, y) && b.Get(x+offset.X, y+offset.Y) {
+					want = true
+				}
+			}
+		}
+		assert.Equal(t, want, b.Intersects(other, offset))
+
+		count := b.Count()
+		b.Or(other, offset)
+		for y := src.Rect.Min.Y; y < src.Rect.Max.Y; y++ {
+			for x := src.Rect.Min.X; x < src.Rect.Max.X; x++ {
+				if other.Get(x, y) && image.Pt(x, y).Add(offset).In(dst.Rect) {
+					assert.True(t, b.Get(x+offset.X, y+offset.Y))
+				}
+			}
+		}
+		if !want {
+			// All the pixels of other that are inside b are added.
+			added := 0
+			for y := src.Rect.Min.Y; y < src.Rect.Max.Y; y++ {
+				for x := src.Rect.Min.X; x < src.Rect.Max.X; x++ {
+					if other.Get(x, y) && image.Pt(x, y).Add(offset).In(dst.Rect) {
+						added++
+					}
+				}
+			}
+			assert.Equal(t, count+added, b.Count())
+		}
+	}
+}
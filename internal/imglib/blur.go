@@ -0,0 +1,70 @@
+package imglib
+
+import (
+	"image"
+	"image/color"
+)
+
+// Blur returns a blurred copy of the image, using a box blur with the given radius. The blur is
+// applied three times, which approximates a gaussian blur.
+func Blur(src image.Image, radius int) *image.RGBA {
+	dst := RGBA(src)
+	if radius <= 0 {
+		return dst
+	}
+	tmp := image.NewRGBA(dst.Rect)
+	for i := 0; i < 3; i++ {
+		boxBlur(tmp, dst, radius, true)
+		boxBlur(dst, tmp, radius, false)
+	}
+	return dst
+}
+
+// boxBlur blurs the rows of src into dst if horizontal is set, otherwise it blurs the columns.
+func boxBlur(dst, src *image.RGBA, radius int, horizontal bool) {
+	rect := src.Rect
+	lines, length := rect.Dy(), rect.Dx()
+	if !horizontal {
+		lines, length = length, lines
+	}
+	at := func(line, i int) image.Point {
+		if horizontal {
+			return image.Pt(rect.Min.X+i, rect.Min.Y+line)
+		}
+		return image.Pt(rect.Min.X+line, rect.Min.Y+i)
+	}
+
+	for line := 0; line < lines; line++ {
+		// Keep a running sum of the window, in which the edges are repeated.
+		var sum [4]int
+		pix := func(i int) []uint8 {
+			if i < 0 {
+				i = 0
+			} else if i >= length {
+				i = length - 1
+			}
+			p := at(line, i)
+			off := src.PixOffset(p.X, p.Y)
+			return src.Pix[off : off+4]
+		}
+		for i := -radius; i <= radius; i++ {
+			for c, v := range pix(i) {
+				sum[c] += int(v)
+			}
+		}
+		n := 2*radius + 1
+		for i := 0; i < length; i++ {
+			p := at(line, i)
+			dst.SetRGBA(p.X, p.Y, color.RGBA{
+				R: uint8(sum[0] / n),
+				G: uint8(sum[1] / n),
+				B: uint8(sum[2] / n),
+				A: uint8(sum[3] / n),
+			})
+			out, in := pix(i-radius), pix(i+radius+1)
+			for c := range sum {
+				sum[c] += int(in[c]) - int(out[c])
+			}
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package imglib
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlur(t *testing.T) {
+	t.Parallel()
+
+	img := image.NewRGBA(image.Rect(0, 0, 9, 9))
+	img.Set(4, 4, color.White)
+
+	got := Blur(img, 1)
+	assert.Equal(t, img.Bounds(), got.Bounds())
+	// The center pixel spreads to its neighbours, and the total brightness is about the same.
+	var sum int
+	for _, v := range got.Pix {
+		sum += int(v)
+	}
+	assert.InDelta(t, 4*255, sum, 4*50)
+	assert.True(t, got.RGBAAt(4, 4).A < 255)
+	assert.True(t, got.RGBAAt(3, 4).A > 0)
+	assert.Equal(t, color.RGBA{}, got.RGBAAt(0, 0))
+
+	// Blurring with no radius copies the image.
+	assert.Equal(t, img, Blur(img, 0))
+}
@@ -14,8 +14,10 @@ func RGBA(src image.Image) *image.RGBA {
 	return dst
 }
 
-// WithModel returns an image with different color model. The image is not copied.
+// WithModel returns an image with different color model. The image is not copied, but lazy
+// images are rendered.
 func WithModel(parent image.Image, model color.Model) image.Image {
+	parent = Render(parent)
 	return img{
 		parent: parent,
 		rect:   parent.Bounds(),
@@ -37,10 +39,48 @@ func SubImage(parent image.Image, rect image.Rectangle) image.Image {
 	}
 }
 
+// Mask returns the image in the intersection of the given image and rectangle, in which only the
+// pixels where the mask is not transparent are part of the image. The mask is aligned to the
+// given rectangle. The image is not copied.
+func Mask(parent image.Image, rect image.Rectangle, mask image.Image) image.Image {
+	sub := SubImage(parent, rect)
+	i, ok := sub.(img)
+	if !ok {
+		return sub
+	}
+	i.mask = mask
+	i.maskOffset = mask.Bounds().Min.Sub(rect.Min)
+	return i
+}
+
+// MaskOf returns the mask of an image that was returned by Mask, and the offset of the mask, such
+// that the pixel p of the image is masked by the pixel p+offset of the mask. It returns nil if the
+// image has no mask.
+func MaskOf(im image.Image) (image.Image, image.Point) {
+	i, ok := im.(img)
+	if !ok || i.mask == nil {
+		return nil, image.ZP
+	}
+	return i.mask, i.maskOffset
+}
+
+// Masked returns whether a pixel is excluded from the given image by a mask.
+func Masked(im image.Image, x, y int) bool {
+	i, ok := im.(img)
+	if !ok || i.mask == nil {
+		return false
+	}
+	_, _, _, a := i.mask.At(x+i.maskOffset.X, y+i.maskOffset.Y).RGBA()
+	return a == 0
+}
+
 type img struct {
 	parent image.Image
 	rect   image.Rectangle
 	model  color.Model
+	// mask optionally excludes pixels from the image. It is aligned to the image using the offset.
+	mask       image.Image
+	maskOffset image.Point
 }
 
 func (i img) Bounds() image.Rectangle {
@@ -52,6 +92,9 @@ func (i img) ColorModel() color.Model {
 }
 
 func (i img) At(x, y int) color.Color {
+	if Masked(i, x, y) {
+		return color.Transparent
+	}
 	c := i.parent.At(x, y)
 	if i.model != i.parent.ColorModel() {
 		c = i.model.Convert(c)
@@ -62,3 +105,43 @@ func (i img) At(x, y int) color.Color {
 func Area(r image.Rectangle) int {
 	return r.Dx() * r.Dy()
 }
+
+// Variance returns the color variance of an area of an image in range [0..1]. It is the sum of
+// the variances of all the color components, including alpha, each at most 0.25.
+func Variance(img image.Image, rect image.Rectangle) float64 {
+	rect = rect.Intersect(img.Bounds())
+	n := float64(Area(rect))
+	if n == 0 {
+		return 0
+	}
+	var sum, sumSq [4]float64
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			r, g, b, a := img.At(x, y).RGBA()
+			for i, c := range [4]uint32{r, g, b, a} {
+				v := float64(c) / 0xffff
+				sum[i] += v
+				sumSq[i] += v * v
+			}
+		}
+	}
+	var variance float64
+	for i := range sum {
+		mean := sum[i] / n
+		variance += sumSq[i]/n - mean*mean
+	}
+	return variance
+}
+
+// Transparent returns whether all the pixels of an image are fully transparent.
+func Transparent(img image.Image) bool {
+	r := img.Bounds()
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a != 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
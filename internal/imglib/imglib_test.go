@@ -0,0 +1,36 @@
+package imglib
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVariance(t *testing.T) {
+	t.Parallel()
+
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	assert.Equal(t, 0.0, Variance(img, img.Bounds()))
+
+	// Half black and half white, all opaque.
+	img.Set(0, 0, color.White)
+	img.Set(1, 0, color.White)
+	img.Set(0, 1, color.Black)
+	img.Set(1, 1, color.Black)
+	assert.InDelta(t, 0.75, Variance(img, img.Bounds()), 1e-9)
+	assert.Equal(t, 0.0, Variance(img, image.Rect(0, 0, 2, 1)))
+	assert.Equal(t, 0.0, Variance(img, image.Rect(5, 5, 6, 6)))
+}
+
+func TestTransparent(t *testing.T) {
+	t.Parallel()
+
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	assert.True(t, Transparent(img))
+
+	img.Set(1, 1, color.RGBA{0, 0, 0, 1})
+	assert.False(t, Transparent(img))
+	assert.True(t, Transparent(SubImage(img, image.Rect(0, 0, 1, 2))))
+}
@@ -0,0 +1,29 @@
+package imglib
+
+import (
+	"math"
+
+	"golang.org/x/image/draw"
+)
+
+// Lanczos is a Lanczos resampling kernel with a support of 3 pixels. It is sharper than
+// draw.CatmullRom, and it is also the slowest.
+var Lanczos = &draw.Kernel{Support: 3, At: lanczos3}
+
+func lanczos3(t float64) float64 {
+	if t < 0 {
+		t = -t
+	}
+	if t >= 3 {
+		return 0
+	}
+	return sinc(t) * sinc(t/3)
+}
+
+func sinc(t float64) float64 {
+	if t == 0 {
+		return 1
+	}
+	t *= math.Pi
+	return math.Sin(t) / t
+}
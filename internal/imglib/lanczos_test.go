@@ -0,0 +1,18 @@
+package imglib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLanczos(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, 1.0, lanczos3(0))
+	for _, x := range []float64{1, 2, -2, 3, 4} {
+		assert.InDelta(t, 0, lanczos3(x), 1e-9, "x=%v", x)
+	}
+	assert.Equal(t, lanczos3(0.5), lanczos3(-0.5))
+	assert.True(t, lanczos3(1.5) < 0)
+}
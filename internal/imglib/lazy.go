@@ -0,0 +1,134 @@
+package imglib
+
+import (
+	"container/list"
+	"image"
+	"image/color"
+	"sync"
+)
+
+// Cache holds the pixels of lazy images, up to a budget of bytes. When the budget is exceeded,
+// the least recently used images are evicted, and rendered again when they are needed.
+type Cache struct {
+	mu     sync.Mutex
+	budget int64
+	// reserved is the number of bytes that are held outside of the cache, and size is the number
+	// of bytes of the cached pixels.
+	reserved, size int64
+	// lru holds the cached images, the most recently used first.
+	lru *list.List
+}
+
+// NewCache returns a cache with the given budget of bytes. A budget of zero is unlimited.
+func NewCache(budget int64) *Cache {
+	return &Cache{budget: budget, lru: list.New()}
+}
+
+// Lazy returns an image with the given bounds, whose pixels are rendered by the given function
+// only when they are needed. If the pixels were already rendered, they can be given and they are
+// cached if the budget allows it. Otherwise, rendered should be nil.
+func (c *Cache) Lazy(rect image.Rectangle, render func() *image.RGBA, rendered *image.RGBA) image.Image {
+	l := &lazy{rect: rect, render: render, cache: c}
+	if rendered != nil {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.put(l, rendered)
+	}
+	return l
+}
+
+// Reserve accounts bytes that are held outside of the cache against its budget, evicting cached
+// pixels as needed. It returns false if the reserved bytes exceed the budget.
+func (c *Cache) Reserve(n int64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reserved += n
+	c.evict(0)
+	return c.budget == 0 || c.reserved <= c.budget
+}
+
+// Reserved returns the number of bytes that are reserved outside of the cache.
+func (c *Cache) Reserved() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.reserved
+}
+
+// Render returns the pixels of a lazy image, rendering them if they are not cached. Other images
+// are returned as is.
+func Render(img image.Image) image.Image {
+	if l, ok := img.(*lazy); ok {
+		return l.cache.get(l)
+	}
+	return img
+}
+
+func (c *Cache) get(l *lazy) *image.RGBA {
+	c.mu.Lock()
+	if l.rendered != nil {
+		c.lru.MoveToFront(l.elem)
+		rendered := l.rendered
+		c.mu.Unlock()
+		return rendered
+	}
+	c.mu.Unlock()
+
+	// Render without holding the lock. Concurrent renders of the same image are cached once.
+	rendered := l.render()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if l.rendered == nil {
+		c.put(l, rendered)
+	}
+	return rendered
+}
+
+// put caches the pixels of a lazy image, if they fit in the budget. It must be called with the
+// lock held.
+func (c *Cache) put(l *lazy, rendered *image.RGBA) {
+	n := int64(len(rendered.Pix))
+	if c.budget > 0 && c.reserved+n > c.budget {
+		return
+	}
+	c.evict(n)
+	l.rendered = rendered
+	l.elem = c.lru.PushFront(l)
+	c.size += n
+}
+
+// evict removes the least recently used pixels until the given number of bytes can be added
+// within the budget. It must be called with the lock held.
+func (c *Cache) evict(n int64) {
+	if c.budget == 0 {
+		return
+	}
+	for c.lru.Len() > 0 && c.reserved+c.size+n > c.budget {
+		l := c.lru.Remove(c.lru.Back()).(*lazy)
+		c.size -= int64(len(l.rendered.Pix))
+		l.rendered, l.elem = nil, nil
+	}
+}
+
+// lazy is an image that is rendered only when its pixels are needed.
+type lazy struct {
+	rect   image.Rectangle
+	render func() *image.RGBA
+	cache  *Cache
+	// rendered and elem are the cached pixels and their position in the cache. They are guarded
+	// by the cache lock.
+	rendered *image.RGBA
+	elem     *list.Element
+}
+
+func (l *lazy) Bounds() image.Rectangle {
+	return l.rect
+}
+
+func (l *lazy) ColorModel() color.Model {
+	return color.RGBAModel
+}
+
+// At returns the color of a pixel. Accessing many pixels should be done on the result of Render.
+func (l *lazy) At(x, y int) color.Color {
+	return l.cache.get(l).At(x, y)
+}
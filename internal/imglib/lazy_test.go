@@ -0,0 +1,56 @@
+package imglib
+
+import (
+	"image"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache(t *testing.T) {
+	t.Parallel()
+
+	// Each image is 4 pixels of 4 bytes, and the cache can hold two images.
+	c := NewCache(32)
+	renders := make([]int, 3)
+	var imgs []image.Image
+	for i := range renders {
+		i := i
+		render := func() *image.RGBA {
+			renders[i]++
+			return image.NewRGBA(image.Rect(0, 0, 2, 2))
+		}
+		imgs = append(imgs, c.Lazy(image.Rect(0, 0, 2, 2), render, render()))
+	}
+	assert.Equal(t, []int{1, 1, 1}, renders)
+
+	// The first image was evicted, and rendering it evicts the second.
+	assert.Equal(t, image.Rect(0, 0, 2, 2), imgs[0].Bounds())
+	Render(imgs[2])
+	Render(imgs[0])
+	assert.Equal(t, []int{2, 1, 1}, renders)
+	Render(imgs[2])
+	Render(imgs[0])
+	assert.Equal(t, []int{2, 1, 1}, renders)
+	Render(imgs[1])
+	assert.Equal(t, []int{2, 2, 1}, renders)
+
+	// Reserving bytes leaves room for one image, and evicts the least recently used.
+	assert.True(t, c.Reserve(16))
+	Render(imgs[1])
+	assert.Equal(t, []int{2, 2, 1}, renders)
+	Render(imgs[0])
+	Render(imgs[1])
+	assert.Equal(t, []int{3, 3, 1}, renders)
+	assert.False(t, c.Reserve(17))
+
+	// Images that were not rendered are rendered when needed.
+	img := c.Lazy(image.Rect(0, 0, 2, 2), imgs[2].(*lazy).render, nil)
+	assert.Equal(t, []int{3, 3, 1}, renders)
+	Render(img)
+	assert.Equal(t, []int{3, 3, 2}, renders)
+
+	// Other images are returned as is.
+	rgba := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	assert.Equal(t, rgba, Render(rgba))
+}
@@ -0,0 +1,65 @@
+package imglib
+
+import (
+	"image"
+	"math"
+)
+
+// Orientation estimates the dominant edge direction of an image from the structure tensor of its
+// luminance gradients. The angle is in radians, in range [0..π), measured clockwise from the x
+// axis. The coherence is in range [0..1], where 0 means that there is no dominant direction, and
+// 1 means that all the gradients are parallel. Pixels that are excluded by a mask are ignored, such
+// that the edges of the mask are not considered as edges of the image.
+func Orientation(img image.Image) (angle, coherence float64) {
+	rect := img.Bounds()
+	if rect.Dx() < 3 || rect.Dy() < 3 {
+		return 0, 0
+	}
+	var (
+		lum = make([]float64, rect.Dx()*rect.Dy())
+		// in holds the pixels that are not masked.
+		in = make([]bool, len(lum))
+	)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			if Masked(img, x, y) {
+				continue
+			}
+			// Colors are alpha premultiplied, such that edges of transparent areas count as edges.
+			r, g, b, _ := img.At(x, y).RGBA()
+			l := 0.2126*float64(r) + 0.7152*float64(g) + 0.0722*float64(b)
+			i := (y-rect.Min.Y)*rect.Dx() + x - rect.Min.X
+			lum[i], in[i] = l/0xffff, true
+		}
+	}
+
+	// Sum the structure tensor components from the central differences gradients, of the pixels
+	// whose gradients don't depend on masked pixels.
+	var jxx, jyy, jxy float64
+	w := rect.Dx()
+	for y := 1; y < rect.Dy()-1; y++ {
+		for x := 1; x < w-1; x++ {
+			i := y*w + x
+			if !in[i] || !in[i-1] || !in[i+1] || !in[i-w] || !in[i+w] {
+				continue
+			}
+			gx := (lum[y*w+x+1] - lum[y*w+x-1]) / 2
+			gy := (lum[(y+1)*w+x] - lum[(y-1)*w+x]) / 2
+			jxx += gx * gx
+			jyy += gy * gy
+			jxy += gx * gy
+		}
+	}
+	trace := jxx + jyy
+	if trace == 0 {
+		return 0, 0
+	}
+	coherence = math.Sqrt((jxx-jyy)*(jxx-jyy)+4*jxy*jxy) / trace
+
+	// The dominant gradient direction is perpendicular to the edges.
+	angle = 0.5*math.Atan2(2*jxy, jxx-jyy) + math.Pi/2
+	if angle >= math.Pi {
+		angle -= math.Pi
+	}
+	return angle, coherence
+}
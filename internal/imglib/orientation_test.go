@@ -0,0 +1,69 @@
+package imglib
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrientation(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		// white returns whether a pixel is white.
+		white func(x, y int) bool
+		want  float64
+	}{
+		{name: "horizontal stripes", white: func(x, y int) bool { return y%4 < 2 }, want: 0},
+		{name: "vertical stripes", white: func(x, y int) bool { return x%4 < 2 }, want: math.Pi / 2},
+		{name: "diagonal", white: func(x, y int) bool { return x < y }, want: math.Pi / 4},
+		{name: "anti diagonal", white: func(x, y int) bool { return x+y < 16 }, want: 3 * math.Pi / 4},
+	}
+
+	for _, tt := range tests {
+		img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+		for y := 0; y < 16; y++ {
+			for x := 0; x < 16; x++ {
+				if tt.white(x, y) {
+					img.Set(x, y, color.White)
+				} else {
+					img.Set(x, y, color.Black)
+				}
+			}
+		}
+		angle, coherence := Orientation(img)
+		assert.InDelta(t, tt.want, angle, 1e-9, tt.name)
+		assert.InDelta(t, 1, coherence, 1e-9, tt.name)
+	}
+
+	// A uniform image has no orientation.
+	_, coherence := Orientation(image.NewRGBA(image.Rect(0, 0, 8, 8)))
+	assert.Equal(t, 0.0, coherence)
+
+	// The edges of a mask are not edges of the image.
+	white := image.NewUniform(color.White)
+	hex := Polygon(image.Pt(16, 16), [2]float64{0.5, 0}, [2]float64{1, 0.25}, [2]float64{1, 0.75},
+		[2]float64{0.5, 1}, [2]float64{0, 0.75}, [2]float64{0, 0.25})
+	triangle := Polygon(image.Pt(16, 16), [2]float64{0.5, 0}, [2]float64{1, 1}, [2]float64{0, 1})
+	for _, mask := range []image.Image{hex, triangle} {
+		_, coherence = Orientation(Mask(white, image.Rect(4, 4, 20, 20), mask))
+		assert.InDelta(t, 0, coherence, 1e-9)
+	}
+
+	// Edges inside the mask are detected.
+	stripes := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			if x%4 < 2 {
+				stripes.Set(x, y, color.White)
+			}
+		}
+	}
+	angle, coherence := Orientation(Mask(stripes, stripes.Rect, hex))
+	assert.InDelta(t, math.Pi/2, angle, 1e-9)
+	assert.InDelta(t, 1, coherence, 1e-9)
+}
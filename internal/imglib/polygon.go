@@ -0,0 +1,35 @@
+package imglib
+
+import (
+	"image"
+	"image/color"
+)
+
+// Polygon returns a mask in the given size, which is opaque inside the polygon defined by the
+// given vertices. The vertices are relative to the size, in range [0..1].
+func Polygon(size image.Point, vertices ...[2]float64) *image.Alpha {
+	mask := image.NewAlpha(image.Rectangle{Max: size})
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			// Test the center of the pixel.
+			px := (float64(x) + 0.5) / float64(size.X)
+			py := (float64(y) + 0.5) / float64(size.Y)
+			if inPolygon(px, py, vertices) {
+				mask.SetAlpha(x, y, color.Alpha{A: 0xff})
+			}
+		}
+	}
+	return mask
+}
+
+// inPolygon tests if a point is inside a polygon using the even-odd rule.
+func inPolygon(x, y float64, vertices [][2]float64) bool {
+	in := false
+	for i, j := 0, len(vertices)-1; i < len(vertices); j, i = i, i+1 {
+		vi, vj := vertices[i], vertices[j]
+		if (vi[1] > y) != (vj[1] > y) && x < (vj[0]-vi[0])*(y-vi[1])/(vj[1]-vi[1])+vi[0] {
+			in = !in
+		}
+	}
+	return in
+}
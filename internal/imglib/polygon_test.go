@@ -0,0 +1,35 @@
+package imglib
+
+import (
+	"image"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolygon(t *testing.T) {
+	t.Parallel()
+
+	// A triangle pointing down in a 5x2 rectangle.
+	mask := Polygon(image.Pt(5, 2), [2]float64{0, 0}, [2]float64{1, 0}, [2]float64{0.5, 1})
+	want := []uint8{
+		0, 0xff, 0xff, 0xff, 0,
+		0, 0, 0xff, 0, 0,
+	}
+	assert.Equal(t, want, mask.Pix)
+}
+
+func TestMask(t *testing.T) {
+	t.Parallel()
+
+	parent := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	mask := Polygon(image.Pt(5, 2), [2]float64{0, 0}, [2]float64{1, 0}, [2]float64{0.5, 1})
+	img := Mask(parent, image.Rect(7, 2, 12, 4), mask)
+
+	assert.Equal(t, image.Rect(7, 2, 10, 4), img.Bounds())
+	assert.True(t, Masked(img, 7, 2))
+	assert.False(t, Masked(img, 8, 2))
+	assert.False(t, Masked(img, 9, 3))
+	assert.True(t, Masked(img, 8, 3))
+	assert.False(t, Masked(parent, 8, 3))
+}
@@ -0,0 +1,92 @@
+package imglib
+
+import (
+	"image"
+	"math"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/math/f64"
+)
+
+// Scale returns a copy of the image, scaled by the given factor.
+func Scale(img image.Image, scale float64, filter draw.Interpolator) *image.RGBA {
+	img = Render(img)
+	dst := image.NewRGBA(image.Rectangle{Max: ScaledSize(img.Bounds().Size(), scale)})
+	filter.Scale(dst, dst.Rect, img, img.Bounds(), draw.Src, nil)
+	return dst
+}
+
+// ScaledSize returns the size of an image of the given size after Scale.
+func ScaledSize(size image.Point, scale float64) image.Point {
+	return image.Pt(ceil(scale*float64(size.X)), ceil(scale*float64(size.Y)))
+}
+
+// Rotate returns a copy of the image, rotated clockwise. The rotation is in range [0..1], where 1
+// is a full rotation. The size of the returned image is the bounding box of the rotated image.
+func Rotate(img image.Image, rotation float64, filter draw.Interpolator) *image.RGBA {
+	img = Render(img)
+	sin, cos := math.Sincos(2 * math.Pi * rotation)
+	bounds := image.Rectangle{Max: RotatedSize(img.Bounds().Size(), rotation)}
+	return transform(img, bounds, [4]float64{cos, -sin, sin, cos}, filter)
+}
+
+// RotatedSize returns the size of an image of the given size after Rotate.
+func RotatedSize(size image.Point, rotation float64) image.Point {
+	dx, dy := float64(size.X), float64(size.Y)
+	sin, cos := math.Sincos(2 * math.Pi * rotation)
+	w, h := math.Abs(dx*cos)+math.Abs(dy*sin), math.Abs(dx*sin)+math.Abs(dy*cos)
+	return image.Pt(ceil(w), ceil(h))
+}
+
+// Shear returns a copy of the image, sheared horizontally by the given slope.
+func Shear(img image.Image, slope float64, filter draw.Interpolator) *image.RGBA {
+	img = Render(img)
+	bounds := image.Rectangle{Max: ShearedSize(img.Bounds().Size(), slope)}
+	return transform(img, bounds, [4]float64{1, slope, 0, 1}, filter)
+}
+
+// ShearedSize returns the size of an image of the given size after Shear.
+func ShearedSize(size image.Point, slope float64) image.Point {
+	return image.Pt(ceil(float64(size.X)+math.Abs(slope)*float64(size.Y)), size.Y)
+}
+
+// transform draws the image on a new image with the given bounds, applying the given linear
+// transformation around the centers of both images.
+func transform(img image.Image, bounds image.Rectangle, m [4]float64, filter draw.Interpolator) *image.RGBA {
+	src := img.Bounds()
+	sx, sy := float64(src.Min.X)+float64(src.Dx())/2, float64(src.Min.Y)+float64(src.Dy())/2
+	dx, dy := float64(bounds.Min.X)+float64(bounds.Dx())/2, float64(bounds.Min.Y)+float64(bounds.Dy())/2
+	dst := image.NewRGBA(bounds)
+	s2d := f64.Aff3{
+		m[0], m[1], dx - m[0]*sx - m[1]*sy,
+		m[2], m[3], dy - m[2]*sx - m[3]*sy,
+	}
+	filter.Transform(dst, s2d, img, src, draw.Src, nil)
+	return dst
+}
+
+// ceil rounds up a size, ignoring floating point errors.
+func ceil(v float64) int {
+	return int(math.Ceil(v - 1e-9))
+}
+
+// Flip returns a copy of the image, mirrored horizontally, vertically or both.
+func Flip(img image.Image, horizontal, vertical bool) *image.RGBA {
+	img = Render(img)
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	for y := 0; y < b.Dy(); y++ {
+		sy := b.Min.Y + y
+		if vertical {
+			sy = b.Max.Y - 1 - y
+		}
+		for x := 0; x < b.Dx(); x++ {
+			sx := b.Min.X + x
+			if horizontal {
+				sx = b.Max.X - 1 - x
+			}
+			dst.Set(x, y, img.At(sx, sy))
+		}
+	}
+	return dst
+}
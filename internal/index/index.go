@@ -0,0 +1,245 @@
+// Package index provides nearest neighbour lookup of modes.
+package index
+
+import (
+	"image/color"
+	"math"
+	"sort"
+
+	"github.com/posener/tiler/internal/clrlib"
+	"github.com/posener/tiler/internal/mode"
+)
+
+// leafSize is the maximal number of modes in a tree leaf.
+const leafSize = 8
+
+// Index finds the closest mode to a given mode. It uses a k-d tree over the modes colors, and
+// falls back to a linear scan when the modes can't be indexed.
+type Index struct {
+	modes    []mode.Mode
+	distance clrlib.DistanceFunc
+	space    *clrlib.Space
+	root     *node
+	// rest are indices of modes that are not in the tree.
+	rest []int
+	// tint is whether the distances are computed with Mode.TintDistance.
+	tint bool
+}
+
+type node struct {
+	// min and max are the bounding box of all the coordinates in the node.
+	min, max [3]float64
+	// maxFreq is the maximal mode frequency in the node.
+	maxFreq float64
+	// Leaves hold the indices of their modes. Other nodes have two children.
+	items       []item
+	left, right *node
+}
+
+type item struct {
+	i      int
+	coords [3]float64
+}
+
+// New returns an index of the given modes, with the given color distance function. The space
+// must be the space of the distance function, or nil if the distance function has no space, in
+// which case all lookups are a linear scan. Modes with a grid signature are not indexed.
+func New(modes []mode.Mode, distance clrlib.DistanceFunc, space *clrlib.Space) *Index {
+	ix := &Index{modes: modes, distance: distance, space: space}
+	var items []item
+	for i, m := range modes {
+		if space == nil || len(m.Grid) > 0 || isTransparent(m.Color) {
+			ix.rest = append(ix.rest, i)
+			continue
+		}
+		items = append(items, item{i: i, coords: space.Coords(m.Color)})
+	}
+	if len(items) > 0 {
+		ix.root = ix.build(items)
+	}
+	return ix
+}
+
+// NewTinted returns an index of the given modes, which finds the closest mode according to
+// Mode.TintDistance. Lookups are a linear scan.
+func NewTinted(modes []mode.Mode, distance clrlib.DistanceFunc) *Index {
+	ix := New(modes, distance, nil)
+	ix.tint = true
+	return ix
+}
+
+// Nearest returns the closest mode to the given mode and its distance. It returns the same result
+// as a linear scan that prefers the first mode in case of equal distances, and the first mode if
+// all distances are not smaller than 1. It returns false if the index is empty or the given mode
+// is transparent.
+func (ix *Index) Nearest(m mode.Mode) (mode.Mode, float64, bool) {
+	if len(ix.modes) == 0 || isTransparent(m.Color) {
+		return mode.Mode{}, 0, false
+	}
+	s := ix.search(m, 1, 1)
+	if len(s.results) == 0 {
+		return ix.modes[0], 1, true
+	}
+	return ix.modes[s.results[0].i], s.results[0].dist, true
+}
+
+// KNearest returns the k closest modes to the given mode, and their distances. They are ordered
+// by their distance, and then by their order in the index. It returns less than k modes if the
+// index has less modes, and nothing if the given mode is transparent.
+func (ix *Index) KNearest(m mode.Mode, k int) ([]mode.Mode, []float64) {
+	if len(ix.modes) == 0 || k <= 0 || isTransparent(m.Color) {
+		return nil, nil
+	}
+	s := ix.search(m, k, math.Inf(1))
+	modes := make([]mode.Mode, len(s.results))
+	dists := make([]float64, len(s.results))
+	for j, r := range s.results {
+		modes[j], dists[j] = ix.modes[r.i], r.dist
+	}
+	return modes, dists
+}
+
+// search finds the k closest modes to the given mode, which are closer than maxDist.
+func (ix *Index) search(m mode.Mode, k int, maxDist float64) *search {
+	s := &search{ix: ix, m: m, k: k, maxDist: maxDist}
+	if ix.root != nil {
+		s.coords = ix.space.Coords(m.Color)
+		s.visit(ix.root)
+	}
+	for _, i := range ix.rest {
+		s.check(i)
+	}
+	return s
+}
+
+type search struct {
+	ix      *Index
+	m       mode.Mode
+	coords  [3]float64
+	k       int
+	maxDist float64
+	// results are the closest modes so far, ordered by their distance and index.
+	results []result
+}
+
+type result struct {
+	i    int
+	dist float64
+}
+
+func (s *search) visit(n *node) {
+	if s.lowerBound(n) > s.bound() {
+		return
+	}
+	if n.items != nil {
+		for _, it := range n.items {
+			s.check(it.i)
+		}
+		return
+	}
+	// Visit the closer child first, to improve pruning of the other one.
+	first, second := n.left, n.right
+	if sqDist(s.coords, second) < sqDist(s.coords, first) {
+		first, second = second, first
+	}
+	s.visit(first)
+	s.visit(second)
+}
+
+func (s *search) check(i int) {
+	var dist float64
+	if s.ix.tint {
+		dist = s.m.TintDistance(s.ix.modes[i], s.ix.distance)
+	} else {
+		dist = s.m.Distance(s.ix.modes[i], s.ix.distance)
+	}
+	r := result{i: i, dist: dist}
+	if len(s.results) < s.k {
+		if dist >= s.maxDist {
+			return
+		}
+		s.results = append(s.results, r)
+	} else if last := s.results[len(s.results)-1]; r.less(last) {
+		s.results[len(s.results)-1] = r
+	} else {
+		return
+	}
+	// Move the new result to its place.
+	for j := len(s.results) - 1; j > 0 && s.results[j].less(s.results[j-1]); j-- {
+		s.results[j], s.results[j-1] = s.results[j-1], s.results[j]
+	}
+}
+
+// bound returns the distance above which modes can't be in the results.
+func (s *search) bound() float64 {
+	if len(s.results) < s.k {
+		return s.maxDist
+	}
+	return s.results[len(s.results)-1].dist
+}
+
+func (r result) less(other result) bool {
+	return r.dist < other.dist || (r.dist == other.dist && r.i < other.i)
+}
+
+// lowerBound returns a lower bound of the distance of the searched mode from all modes in the
+// node.
+func (s *search) lowerBound(n *node) float64 {
+	return s.ix.space.Bound(sqDist(s.coords, n)) / s.m.Freq / n.maxFreq
+}
+
+func (ix *Index) build(items []item) *node {
+	n := &node{}
+	for d := 0; d < 3; d++ {
+		n.min[d], n.max[d] = math.Inf(1), math.Inf(-1)
+	}
+	for _, it := range items {
+		for d := 0; d < 3; d++ {
+			n.min[d] = math.Min(n.min[d], it.coords[d])
+			n.max[d] = math.Max(n.max[d], it.coords[d])
+		}
+		n.maxFreq = math.Max(n.maxFreq, ix.modes[it.i].Freq)
+	}
+	if len(items) <= leafSize {
+		n.items = items
+		return n
+	}
+
+	// Split by the median of the dimension with the largest spread.
+	dim := 0
+	for d := 1; d < 3; d++ {
+		if n.max[d]-n.min[d] > n.max[dim]-n.min[dim] {
+			dim = d
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].coords[dim] < items[j].coords[dim] })
+	mid := len(items) / 2
+	n.left = ix.build(items[:mid])
+	n.right = ix.build(items[mid:])
+	return n
+}
+
+// sqDist returns the squared euclidean distance between the given coordinates and the bounding
+// box of the node.
+func sqDist(coords [3]float64, n *node) float64 {
+	var sq float64
+	for d := 0; d < 3; d++ {
+		var diff float64
+		switch {
+		case coords[d] < n.min[d]:
+			diff = n.min[d] - coords[d]
+		case coords[d] > n.max[d]:
+			diff = coords[d] - n.max[d]
+		}
+		sq += diff * diff
+	}
+	return sq
+}
+
+func isTransparent(c color.Color) bool {
+	if c == nil {
+		return true
+	}
+	_, _, _, a := c.RGBA()
+	return a == 0
+}
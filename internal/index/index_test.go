@@ -0,0 +1,121 @@
+package index
+
+import (
+	"image/color"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/posener/tiler/internal/clrlib"
+	"github.com/posener/tiler/internal/mode"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNearest(t *testing.T) {
+	t.Parallel()
+
+	rnd := rand.New(rand.NewSource(1))
+	randMode := func() mode.Mode {
+		c := color.RGBA{uint8(rnd.Intn(256)), uint8(rnd.Intn(256)), uint8(rnd.Intn(256)), 255}
+		// Add some repeated colors and transparent modes.
+		switch rnd.Intn(10) {
+		case 0:
+			c = color.RGBA{}
+		case 1:
+			c = color.RGBA{128, 128, 128, 255}
+		}
+		return mode.Mode{Color: c, Freq: 0.1 + 0.9*rnd.Float64()}
+	}
+
+	tests := []struct {
+		name     string
+		distance clrlib.DistanceFunc
+		space    *clrlib.Space
+	}{
+		{name: "rgb", distance: clrlib.Distance, space: &clrlib.RGBSpace},
+		{name: "lab", distance: clrlib.CIE76, space: &clrlib.LabSpace},
+		{name: "linear", distance: clrlib.CIEDE2000},
+	}
+
+	for _, tt := range tests {
+		var modes []mode.Mode
+		for i := 0; i < 500; i++ {
+			modes = append(modes, randMode())
+		}
+		ix := New(modes, tt.distance, tt.space)
+
+		for i := 0; i < 200; i++ {
+			m := randMode()
+			got, gotDist, ok := ix.Nearest(m)
+			want, wantDist, wantOK := linear(m, modes, tt.distance)
+			assert.Equal(t, wantOK, ok, tt.name)
+			assert.Equal(t, want, got, tt.name)
+			assert.Equal(t, wantDist, gotDist, tt.name)
+		}
+	}
+}
+
+func TestKNearest(t *testing.T) {
+	t.Parallel()
+
+	rnd := rand.New(rand.NewSource(1))
+	randMode := func() mode.Mode {
+		c := color.RGBA{uint8(rnd.Intn(256)), uint8(rnd.Intn(256)), uint8(rnd.Intn(256)), 255}
+		if rnd.Intn(10) == 0 {
+			c = color.RGBA{128, 128, 128, 255}
+		}
+		return mode.Mode{Color: c, Freq: 0.1 + 0.9*rnd.Float64()}
+	}
+
+	var modes []mode.Mode
+	for i := 0; i < 300; i++ {
+		m := randMode()
+		m.Source = i
+		modes = append(modes, m)
+	}
+	ix := New(modes, clrlib.Distance, &clrlib.RGBSpace)
+
+	for _, k := range []int{1, 5, 40, 1000} {
+		for i := 0; i < 50; i++ {
+			m := randMode()
+			want := make([]mode.Mode, len(modes))
+			copy(want, modes)
+			sort.SliceStable(want, func(i, j int) bool {
+				return m.Distance(want[i], clrlib.Distance) < m.Distance(want[j], clrlib.Distance)
+			})
+			if k < len(want) {
+				want = want[:k]
+			}
+			got, dists := ix.KNearest(m, k)
+			assert.Equal(t, want, got, "k=%d", k)
+			if assert.Len(t, dists, len(want)) {
+				for j := range want {
+					assert.Equal(t, m.Distance(want[j], clrlib.Distance), dists[j])
+				}
+			}
+		}
+	}
+
+	got, _ := ix.KNearest(mode.Mode{Color: color.RGBA{}}, 3)
+	assert.Empty(t, got)
+}
+
+func TestNearestEmpty(t *testing.T) {
+	t.Parallel()
+
+	_, _, ok := New(nil, clrlib.Distance, &clrlib.RGBSpace).Nearest(mode.Mode{Color: color.White, Freq: 1})
+	assert.False(t, ok)
+}
+
+func linear(m mode.Mode, others []mode.Mode, distance clrlib.DistanceFunc) (mode.Mode, float64, bool) {
+	if _, _, _, a := m.RGBA(); a == 0 {
+		return mode.Mode{}, 0, false
+	}
+	minMode, minDist := others[0], float64(1)
+	for _, other := range others {
+		if dist := m.Distance(other, distance); dist < minDist {
+			minMode, minDist = other, dist
+		}
+	}
+	return minMode, minDist, true
+}
@@ -3,11 +3,10 @@ package mode
 import (
 	"image"
 	"image/color"
-	"math"
 
-	"github.com/BurntSushi/graphics-go/graphics"
 	"github.com/posener/tiler/internal/clrlib"
 	"github.com/posener/tiler/internal/imglib"
+	"golang.org/x/image/draw"
 )
 
 const quant = clrlib.Quantize(32)
@@ -17,6 +16,13 @@ type Mode struct {
 	image.Image
 	color.Color
 	Freq float64
+	// Grid is an optional spatial signature of the image. It holds the mean colors of a grid of
+	// GridSize cells over the image, row by row.
+	Grid     []color.Color
+	GridSize image.Point
+	// Source is the index of the image that the mode was computed for, when computing modes for
+	// a list of images.
+	Source int
 }
 
 // New returns a Mode of an image. if useTransparent is set, the transparent color will be
@@ -28,6 +34,9 @@ func New(img image.Image, useTransparent bool) Mode {
 		total   float64
 	)
 	for i := imglib.Iterate(img.Bounds(), nil); i.Next(); {
+		if imglib.Masked(img, i.X, i.Y) {
+			continue
+		}
 		c := quant.Convert(img.At(i.X, i.Y))
 		if _, _, _, a := c.RGBA(); a == 0 {
 			if useTransparent {
@@ -52,36 +61,133 @@ func New(img image.Image, useTransparent bool) Mode {
 	}
 }
 
-// Returns a scaled copy of the mode.
-func (m Mode) Scale(scale float64) Mode {
-	m.Image = scaleImage(m.Image, scale)
+// Palette returns a palette of at most n colors that represents the non-transparent colors of the
+// given image. The colors are quantized as in the mode computation.
+func Palette(img image.Image, n int) []color.Color {
+	hist := make(map[color.RGBA]int)
+	for i := imglib.Iterate(img.Bounds(), nil); i.Next(); {
+		if !i.In(img.Bounds()) {
+			continue
+		}
+		c := clrlib.RGBA(quant.Convert(img.At(i.X, i.Y)))
+		if c.A == 0 {
+			continue
+		}
+		hist[c]++
+	}
+	return clrlib.MedianCut(hist, n)
+}
+
+// WithGrid returns a copy of the mode with a grid signature of the given size (columns, rows).
+// An empty size removes the grid signature.
+func (m Mode) WithGrid(size image.Point) Mode {
+	m.GridSize = size
+	m.Grid = nil
+	if size.X <= 0 || size.Y <= 0 {
+		m.GridSize = image.Point{}
+		return m
+	}
+	rect := m.Bounds()
+	img := imglib.Render(m.Image)
+	m.Grid = make([]color.Color, 0, size.X*size.Y)
+	for row := 0; row < size.Y; row++ {
+		for col := 0; col < size.X; col++ {
+			m.Grid = append(m.Grid, meanColor(img, cell(rect, size, col, row)))
+		}
+	}
 	return m
 }
 
+// Returns a scaled copy of the mode.
+func (m Mode) Scale(scale float64, filter draw.Interpolator) Mode {
+	m.Image = imglib.Scale(m.Image, scale, filter)
+	return m.WithGrid(m.GridSize)
+}
+
 // Returns a rotated copy of the mode.
-func (m Mode) Rotate(rotation float64) Mode {
-	m.Image = rotateImage(m.Image, rotation)
-	return m
+func (m Mode) Rotate(rotation float64, filter draw.Interpolator) Mode {
+	m.Image = imglib.Rotate(m.Image, rotation, filter)
+	return m.WithGrid(m.GridSize)
+}
+
+// Flip returns a copy of the mode, mirrored horizontally, vertically or both.
+func (m Mode) Flip(horizontal, vertical bool) Mode {
+	if !horizontal && !vertical {
+		return m
+	}
+	m.Image = imglib.Flip(m.Image, horizontal, vertical)
+	return m.WithGrid(m.GridSize)
 }
 
-func (m Mode) Distance(other Mode) float64 {
-	return clrlib.Distance(m.Color, other.Color) / m.Freq / other.Freq
+// Shear returns a horizontally sheared copy of the mode. The slope is the horizontal shift of each
+// row relative to its distance from the center of the image.
+func (m Mode) Shear(slope float64, filter draw.Interpolator) Mode {
+	if slope == 0 {
+		return m
+	}
+	m.Image = imglib.Shear(m.Image, slope, filter)
+	return m.WithGrid(m.GridSize)
 }
 
-func scaleImage(img image.Image, scale float64) image.Image {
-	dx, dy := float64(img.Bounds().Dx()), float64(img.Bounds().Dy())
-	dx, dy = scale*dx, scale*dy
-	dst := image.NewRGBA(image.Rect(0, 0, int(math.Ceil(dx)), int(math.Ceil(dy))))
-	graphics.Scale(dst, img)
-	return dst
+// Distance returns the distance between the mode and another mode, using the given color
+// distance function. If both modes have a grid signature of the same size, the distance is the
+// mean distance of the grid cells. Otherwise, it is computed from the most common colors.
+func (m Mode) Distance(other Mode, distance clrlib.DistanceFunc) float64 {
+	if len(m.Grid) > 0 && m.GridSize == other.GridSize {
+		var sum float64
+		for i := range m.Grid {
+			sum += distance(m.Grid[i], other.Grid[i])
+		}
+		return sum / float64(len(m.Grid))
+	}
+	return distance(m.Color, other.Color) / m.Freq / other.Freq
 }
 
-func rotateImage(img image.Image, rotation float64) image.Image {
-	angle := 2 * math.Pi * rotation
-	dx, dy := float64(img.Bounds().Dx()), float64(img.Bounds().Dy())
-	cos, sin := math.Cos(angle), math.Sin(angle)
-	dx, dy = dx*cos+dy*sin, dx*sin+dy*cos
-	dst := image.NewRGBA(image.Rect(0, 0, int(math.Ceil(dx)), int(math.Ceil(dy))))
-	graphics.Rotate(dst, img, &graphics.RotateOptions{Angle: angle})
-	return dst
+// TintDistance returns the distance between the mode and another mode, as if the other mode was
+// tinted such that its most common color is the most common color of the mode. If both modes have
+// a grid signature of the same size, the distance is the mean distance of the grid cells.
+// Otherwise, it is computed from the frequencies of the most common colors.
+func (m Mode) TintDistance(other Mode, distance clrlib.DistanceFunc) float64 {
+	if len(m.Grid) > 0 && m.GridSize == other.GridSize {
+		tint := clrlib.NewShift(other.Color, m.Color, 1)
+		var sum float64
+		for i := range m.Grid {
+			sum += distance(m.Grid[i], tint.Convert(other.Grid[i]))
+		}
+		return sum / float64(len(m.Grid))
+	}
+	return 1 - m.Freq*other.Freq
+}
+
+// cell returns the rectangle of the grid cell in the given column and row. Cells are at least one
+// pixel in size, so images that are smaller than the grid still have a color in every cell.
+func cell(rect image.Rectangle, size image.Point, col, row int) image.Rectangle {
+	dx, dy := rect.Dx(), rect.Dy()
+	c := image.Rect(col*dx/size.X, row*dy/size.Y, (col+1)*dx/size.X, (row+1)*dy/size.Y)
+	if c.Dx() == 0 {
+		c.Max.X++
+	}
+	if c.Dy() == 0 {
+		c.Max.Y++
+	}
+	return c.Add(rect.Min).Intersect(rect)
+}
+
+// meanColor returns the mean color of the given area of the image.
+func meanColor(img image.Image, rect image.Rectangle) color.Color {
+	var r, g, b, a, n uint64
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			if imglib.Masked(img, x, y) {
+				continue
+			}
+			cr, cg, cb, ca := img.At(x, y).RGBA()
+			r, g, b, a = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca)
+			n++
+		}
+	}
+	if n == 0 {
+		return color.Transparent
+	}
+	return color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: uint16(a / n)}
 }
@@ -0,0 +1,297 @@
+package tiler
+
+import (
+	"image"
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/posener/tiler/internal/imglib"
+)
+
+// Layout defines how the image is divided into boxes that are matched with tiles.
+type Layout string
+
+// Available layouts.
+const (
+	// LayoutGrid is a rectangular lattice of boxes in the size of each of the tiles, positioned
+	// every Shift pixels.
+	LayoutGrid Layout = "grid"
+	// LayoutQuadtree recursively subdivides the image into quarters as long as their color
+	// variance is above the QuadtreeThreshold, and matches each region with the largest tiles
+	// that fit in it.
+	LayoutQuadtree Layout = "quadtree"
+	// LayoutHex is a honeycomb of hexagonal boxes. Rows are positioned every 3/4 of the tile
+	// height, and every other row is offset by half of the tile width. A non-empty Shift overrides
+	// the columns and rows distances. Tiles are clipped to the shape of their boxes.
+	LayoutHex Layout = "hex"
+	// LayoutBrick is a running bond of rectangular boxes, in which every other row is offset by
+	// half of the tile width. A non-empty Shift overrides the columns and rows distances.
+	LayoutBrick Layout = "brick"
+	// LayoutTriangle is a lattice of alternating upwards and downwards pointing triangular boxes.
+	// Triangles are positioned every half of the tile width. A non-empty Shift overrides the
+	// columns and rows distances. Tiles are clipped to the shape of their boxes.
+	LayoutTriangle Layout = "triangle"
+	// LayoutPoisson scatters boxes randomly using Poisson-disk sampling, such that the centers of
+	// boxes of the same size are not closer than the PoissonSpacing times the tile size. Boxes of
+	// centers near the edges of the image are moved into the image.
+	LayoutPoisson Layout = "poisson"
+)
+
+// layoutFn returns the boxes of the image that should be matched with the tiles of each of the
+// given sizes.
+type layoutFn func(img image.Image, sizes []image.Point, cfg Config) map[image.Point][]image.Image
+
+var layouts = map[Layout]layoutFn{
+	"":             gridLayout,
+	LayoutGrid:     gridLayout,
+	LayoutQuadtree: quadtreeLayout,
+	LayoutHex:      hexLayout,
+	LayoutBrick:    brickLayout,
+	LayoutTriangle: triangleLayout,
+	LayoutPoisson:  poissonLayout,
+}
+
+func gridLayout(img image.Image, sizes []image.Point, cfg Config) map[image.Point][]image.Image {
+	boxes := make(map[image.Point][]image.Image, len(sizes))
+	for _, size := range sizes {
+		boxes[size] = grid(img, size, cfg.Shift)
+	}
+	return boxes
+}
+
+// grid returns a list of subimages of the given image according to the given
+// grid size and shift.
+func grid(img image.Image, size, shift image.Point) []image.Image {
+	if shift.Eq(image.ZP) {
+		shift = size
+	}
+	var boxes []image.Image
+	for i := imglib.Iterate(img.Bounds(), &shift); i.Next(); {
+		boxes = append(boxes, imglib.SubImage(img, image.Rectangle{Min: i.Point, Max: i.Add(size)}))
+	}
+	return boxes
+}
+
+func hexLayout(img image.Image, sizes []image.Point, cfg Config) map[image.Point][]image.Image {
+	boxes := make(map[image.Point][]image.Image, len(sizes))
+	for _, size := range sizes {
+		mask := imglib.Polygon(size, [2]float64{0.5, 0}, [2]float64{1, 0.25}, [2]float64{1, 0.75},
+			[2]float64{0.5, 1}, [2]float64{0, 0.75}, [2]float64{0, 0.25})
+		shift := cfg.Shift
+		if shift.Eq(image.ZP) {
+			shift = image.Pt(size.X, size.Y*3/4)
+		}
+		boxes[size] = rows(img, size, shift, shift.X/2, func(int, int) image.Image { return mask })
+	}
+	return boxes
+}
+
+func brickLayout(img image.Image, sizes []image.Point, cfg Config) map[image.Point][]image.Image {
+	boxes := make(map[image.Point][]image.Image, len(sizes))
+	for _, size := range sizes {
+		shift := cfg.Shift
+		if shift.Eq(image.ZP) {
+			shift = size
+		}
+		boxes[size] = rows(img, size, shift, shift.X/2, func(int, int) image.Image { return nil })
+	}
+	return boxes
+}
+
+func triangleLayout(img image.Image, sizes []image.Point, cfg Config) map[image.Point][]image.Image {
+	boxes := make(map[image.Point][]image.Image, len(sizes))
+	for _, size := range sizes {
+		up := imglib.Polygon(size, [2]float64{0.5, 0}, [2]float64{1, 1}, [2]float64{0, 1})
+		down := imglib.Polygon(size, [2]float64{0, 0}, [2]float64{1, 0}, [2]float64{0.5, 1})
+		shift := cfg.Shift
+		if shift.Eq(image.ZP) {
+			shift = image.Pt(size.X/2, size.Y)
+		}
+		boxes[size] = rows(img, size, shift, 0, func(row, col int) image.Image {
+			if (row+col)%2 == 1 {
+				return down
+			}
+			return up
+		})
+	}
+	return boxes
+}
+
+// rows returns boxes in rows, in which every other row is offset by the given offset. The boxes are
+// masked with the mask for their row and column, which may be nil.
+func rows(img image.Image, size, shift image.Point, offset int, mask func(row, col int) image.Image) []image.Image {
+	var (
+		boxes []image.Image
+		rect  = img.Bounds()
+	)
+	for row, y := 0, rect.Min.Y; y < rect.Max.Y; row, y = row+1, y+max(shift.Y, 1) {
+		x := rect.Min.X
+		if row%2 == 1 {
+			x += offset
+		}
+		for col := 0; x < rect.Max.X; col, x = col+1, x+max(shift.X, 1) {
+			box := image.Rectangle{Min: image.Pt(x, y), Max: image.Pt(x, y).Add(size)}
+			if m := mask(row, col); m != nil {
+				boxes = append(boxes, imglib.Mask(img, box, m))
+			} else {
+				boxes = append(boxes, imglib.SubImage(img, box))
+			}
+		}
+	}
+	return boxes
+}
+
+func poissonLayout(img image.Image, sizes []image.Point, cfg Config) map[image.Point][]image.Image {
+	spacing := cfg.PoissonSpacing
+	if spacing <= 0 {
+		spacing = 1
+	}
+	boxes := make(map[image.Point][]image.Image, len(sizes))
+	for _, size := range sizes {
+		// Seed each size independently, so the sampling does not depend on the sizes order.
+		rnd := rand.New(rand.NewSource(cfg.Seed ^ int64(size.X)<<32 ^ int64(size.Y)))
+		radius := spacing * float64(min(size.X, size.Y))
+		for _, center := range poissonDisk(img.Bounds(), radius, rnd) {
+			box := fit(center.Sub(size.Div(2)), size, img.Bounds())
+			boxes[size] = append(boxes[size], imglib.SubImage(img, box))
+		}
+	}
+	return boxes
+}
+
+// poissonDisk samples points in the given rectangle such that no two points are closer than the
+// given radius, using Bridson's algorithm.
+func poissonDisk(rect image.Rectangle, radius float64, rnd *rand.Rand) []image.Point {
+	// attempts is the number of samples around an active point before it is deactivated.
+	const attempts = 30
+
+	radius = math.Max(radius, 1)
+	cellSize := radius / math.Sqrt2
+	cols := int(float64(rect.Dx())/cellSize) + 1
+	rows := int(float64(rect.Dy())/cellSize) + 1
+	// cells hold the index of the point in each cell, plus one, or zero if the cell is empty.
+	cells := make([]int, cols*rows)
+
+	type point struct{ x, y float64 }
+	var points, active []point
+	add := func(p point) {
+		points = append(points, p)
+		active = append(active, p)
+		cells[int(p.y/cellSize)*cols+int(p.x/cellSize)] = len(points)
+	}
+	fits := func(p point) bool {
+		if p.x < 0 || p.y < 0 || p.x >= float64(rect.Dx()) || p.y >= float64(rect.Dy()) {
+			return false
+		}
+		col, row := int(p.x/cellSize), int(p.y/cellSize)
+		for r := max(row-2, 0); r <= min(row+2, rows-1); r++ {
+			for c := max(col-2, 0); c <= min(col+2, cols-1); c++ {
+				if i := cells[r*cols+c]; i > 0 && math.Hypot(points[i-1].x-p.x, points[i-1].y-p.y) < radius {
+					return false
+				}
+			}
+		}
+		return true
+	}
+
+	add(point{x: rnd.Float64() * float64(rect.Dx()), y: rnd.Float64() * float64(rect.Dy())})
+	for len(active) > 0 {
+		i := rnd.Intn(len(active))
+		found := false
+		for j := 0; j < attempts; j++ {
+			angle := 2 * math.Pi * rnd.Float64()
+			dist := radius * (1 + rnd.Float64())
+			p := point{x: active[i].x + dist*math.Cos(angle), y: active[i].y + dist*math.Sin(angle)}
+			if fits(p) {
+				add(p)
+				found = true
+				break
+			}
+		}
+		if !found {
+			active[i] = active[len(active)-1]
+			active = active[:len(active)-1]
+		}
+	}
+
+	centers := make([]image.Point, 0, len(points))
+	for _, p := range points {
+		centers = append(centers, rect.Min.Add(image.Pt(int(p.x), int(p.y))))
+	}
+	return centers
+}
+
+func quadtreeLayout(img image.Image, sizes []image.Point, cfg Config) map[image.Point][]image.Image {
+	// Sort the sizes from the largest to the smallest.
+	sizes = append([]image.Point(nil), sizes...)
+	sort.Slice(sizes, func(i, j int) bool {
+		return imglib.Area(image.Rectangle{Max: sizes[i]}) > imglib.Area(image.Rectangle{Max: sizes[j]})
+	})
+
+	q := quadtree{img: img, sizes: sizes, threshold: cfg.QuadtreeThreshold, boxes: make(map[image.Point][]image.Image)}
+	// The roots of the tree are a grid of the largest tile size.
+	largest := sizes[0]
+	for i := imglib.Iterate(img.Bounds(), &largest); i.Next(); {
+		q.add(image.Rectangle{Min: i.Point, Max: i.Add(largest)}.Intersect(img.Bounds()))
+	}
+	return q.boxes
+}
+
+type quadtree struct {
+	img       image.Image
+	sizes     []image.Point
+	threshold float64
+	boxes     map[image.Point][]image.Image
+}
+
+// add adds a region to the tree. If the region is not uniform enough, it is subdivided.
+func (q *quadtree) add(region image.Rectangle) {
+	if region.Empty() {
+		return
+	}
+	smallest := q.sizes[len(q.sizes)-1]
+	half := region.Size().Div(2)
+	if half.X >= smallest.X && half.Y >= smallest.Y && imglib.Variance(q.img, region) > q.threshold {
+		mid := region.Min.Add(half)
+		q.add(image.Rectangle{Min: region.Min, Max: mid})
+		q.add(image.Rect(mid.X, region.Min.Y, region.Max.X, mid.Y))
+		q.add(image.Rect(region.Min.X, mid.Y, mid.X, region.Max.Y))
+		q.add(image.Rectangle{Min: mid, Max: region.Max})
+		return
+	}
+
+	// Match the leaf with the largest tile that fits in it, centered in the leaf.
+	size := smallest
+	for _, s := range q.sizes {
+		if s.X <= region.Dx() && s.Y <= region.Dy() {
+			size = s
+			break
+		}
+	}
+	box := fit(region.Min.Add(region.Size().Sub(size).Div(2)), size, q.img.Bounds())
+	q.boxes[size] = append(q.boxes[size], imglib.SubImage(q.img, box))
+}
+
+// fit returns a box of the given size at the given corner, moved into the bounds. Tiles are drawn
+// from their top left corner, so a box that is larger than the bounds is aligned to their top left
+// corner, and is clipped only at its bottom and right edges.
+func fit(corner, size image.Point, bounds image.Rectangle) image.Rectangle {
+	corner.X = max(min(corner.X, bounds.Max.X-size.X), bounds.Min.X)
+	corner.Y = max(min(corner.Y, bounds.Max.Y-size.Y), bounds.Min.Y)
+	return image.Rectangle{Min: corner, Max: corner.Add(size)}
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,138 @@
+package tiler
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/posener/tiler/internal/imglib"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuadtreeLayout(t *testing.T) {
+	t.Parallel()
+
+	// The left half of the image is uniform and the right half is a checkerboard.
+	img := uniform(image.Rect(0, 0, 16, 8), color.White)
+	for x := 8; x < 16; x++ {
+		for y := 0; y < 8; y++ {
+			if (x+y)%2 == 0 {
+				img.Set(x, y, color.Black)
+			}
+		}
+	}
+
+	big, small := image.Pt(8, 8), image.Pt(2, 2)
+	boxes := quadtreeLayout(img, []image.Point{small, big}, Config{QuadtreeThreshold: 0.1})
+
+	var bigRects, smallRects []image.Rectangle
+	for _, box := range boxes[big] {
+		bigRects = append(bigRects, box.Bounds())
+	}
+	for _, box := range boxes[small] {
+		smallRects = append(smallRects, box.Bounds())
+	}
+	assert.Equal(t, []image.Rectangle{image.Rect(0, 0, 8, 8)}, bigRects)
+	assert.Len(t, smallRects, 16)
+	for _, r := range smallRects {
+		assert.True(t, r.In(image.Rect(8, 0, 16, 8)), "%v", r)
+	}
+}
+
+func TestHexLayout(t *testing.T) {
+	t.Parallel()
+
+	img := uniform(image.Rect(0, 0, 8, 6), color.White)
+	size := image.Pt(4, 4)
+	boxes := hexLayout(img, []image.Point{size}, Config{})
+
+	var got []image.Point
+	for _, box := range boxes[size] {
+		got = append(got, box.Bounds().Min)
+		// The corners of the boxes are not part of the hexagon.
+		assert.True(t, imglib.Masked(box, box.Bounds().Min.X, box.Bounds().Min.Y))
+	}
+	want := []image.Point{{0, 0}, {4, 0}, {2, 3}, {6, 3}}
+	assert.Equal(t, want, got)
+}
+
+func TestPoissonDisk(t *testing.T) {
+	t.Parallel()
+
+	rect := image.Rect(10, 20, 110, 70)
+	points := poissonDisk(rect, 8, rand.New(rand.NewSource(1)))
+
+	// Bridson's algorithm results in approximately one point per 2*r^2 area.
+	assert.True(t, len(points) > 30, "got only %d points", len(points))
+	for i, p := range points {
+		assert.True(t, p.In(rect), "%v not in %v", p, rect)
+		for _, q := range points[i+1:] {
+			// Points are rounded down to integers.
+			assert.True(t, dist(p, q) > 8-math.Sqrt2, "%v and %v are too close", p, q)
+		}
+	}
+
+	// The same seed results in the same sampling.
+	assert.Equal(t, points, poissonDisk(rect, 8, rand.New(rand.NewSource(1))))
+}
+
+func TestLayoutEdges(t *testing.T) {
+	t.Parallel()
+
+	img := uniform(image.Rect(10, 20, 60, 50), color.White)
+	size := image.Pt(8, 8)
+
+	// Boxes around centers near the edges are moved into the image, and are not clipped.
+	boxes := poissonLayout(img, []image.Point{size}, Config{Seed: 1})
+	assert.True(t, len(boxes[size]) > 10, "got only %d boxes", len(boxes[size]))
+	for _, box := range boxes[size] {
+		assert.Equal(t, size, box.Bounds().Size(), "%v", box.Bounds())
+		assert.True(t, box.Bounds().In(img.Bounds()), "%v", box.Bounds())
+	}
+
+	// A box that is larger than the image is aligned to its top left corner.
+	small := uniform(image.Rect(10, 20, 13, 23), color.White)
+	boxes = quadtreeLayout(small, []image.Point{size}, Config{})
+	if assert.Len(t, boxes[size], 1) {
+		assert.Equal(t, small.Bounds(), boxes[size][0].Bounds())
+	}
+
+	assert.Equal(t, image.Rect(0, 0, 4, 4), fit(image.Pt(-2, -1), image.Pt(4, 4), image.Rect(0, 0, 10, 10)))
+	assert.Equal(t, image.Rect(6, 6, 10, 10), fit(image.Pt(8, 7), image.Pt(4, 4), image.Rect(0, 0, 10, 10)))
+	assert.Equal(t, image.Rect(3, 3, 7, 7), fit(image.Pt(3, 3), image.Pt(4, 4), image.Rect(0, 0, 10, 10)))
+}
+
+func TestTileShapes(t *testing.T) {
+	t.Parallel()
+
+	img := uniform(image.Rect(0, 0, 64, 64), color.White)
+	tile := uniform(image.Rect(0, 0, 8, 8), color.White)
+	tileLayout := func(layout Layout) (*image.RGBA, int) {
+		var placed int
+		cfg := Config{Layout: layout, Logf: func(string, ...interface{}) {}, Placed: func(Placement) { placed++ }}
+		out, err := TileContext(context.Background(), img, []image.Image{tile}, cfg, nil)
+		assert.NoError(t, err)
+		return out.(*image.RGBA), placed
+	}
+	coverage := func(img *image.RGBA) float64 {
+		return float64(imglib.Opaque(img).Count()) / float64(imglib.Area(img.Rect))
+	}
+
+	grid, placed := tileLayout(LayoutGrid)
+	assert.Equal(t, 64, placed)
+	assert.Equal(t, 1.0, coverage(grid))
+
+	// Tiles are drawn in the shape of the boxes, and the shapes don't overlap.
+	triangle, placed := tileLayout(LayoutTriangle)
+	assert.Equal(t, 128, placed)
+	assert.NotEqual(t, grid.Pix, triangle.Pix)
+	// The top left corner is not covered by the first upwards pointing triangle.
+	assert.Equal(t, uint8(0), triangle.RGBAAt(0, 0).A)
+
+	// Only the edges of the image are not covered by hexagons.
+	hex, _ := tileLayout(LayoutHex)
+	assert.InDelta(t, 1, coverage(hex), 0.05)
+}
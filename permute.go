@@ -1,6 +1,11 @@
 package tiler
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
 	"image"
 	"image/color"
 	"sync"
@@ -8,6 +13,7 @@ import (
 	"github.com/posener/tiler/internal/clrlib"
 	"github.com/posener/tiler/internal/imglib"
 	"github.com/posener/tiler/internal/mode"
+	"golang.org/x/image/draw"
 )
 
 // PermuteConfig is configuration for the Permute function.
@@ -15,64 +21,456 @@ type PermuteConfig struct {
 	// NumR, NumG and NumB can configure the specific number of a color component.
 	// To use only the original color set it to 0.
 	NumR, NumG, NumB uint8
+	// Palette creates variants of the given image list, each tinted such that its most common
+	// color is one of the palette colors. If set, NumR, NumG and NumB are ignored.
+	Palette []color.Color
+	// Hue creates variants of the given image list with their hue rotated in the HSV color space.
+	// Values should be in range [0..1], where 1 is a full rotation.
+	Hue []float64
+	// Saturation creates variants of the given image list with their saturation multiplied by the
+	// given factors.
+	Saturation []float64
+	// Brightness creates variants of the given image list with their brightness multiplied by the
+	// given factors. Factors above 1 brighten the images.
+	Brightness []float64
+	// Gamma creates variants of the given image list with the given gamma corrections. Values
+	// above 1 brighten the images. Values must be positive.
+	Gamma []float64
 	// Scale creates different scale variants of the given image list.
 	Scale []float64
 	// Scale creates different rotation variants of the given image list. Values should be in range
 	// [0..1]. A rotation of 0 does not rotate the image and a rotation of 1 is 360 degrees.
 	Rotate []float64
+	// Flip creates mirrored variants of the given image list. Use FlipNone to also keep the
+	// original orientation.
+	Flip []Flip
+	// Shear creates horizontally sheared variants of the given image list. Values are the
+	// horizontal shift of each row relative to its vertical distance from the image center. A
+	// shear of 0 does not shear the image.
+	Shear []float64
+	// Grid is the size of the grid signature of the permutations. See Config.Grid.
+	Grid image.Point
+	// MemoryBudget is the maximal number of bytes for the permutations. The signatures of all the
+	// permutations must fit in the budget, otherwise ErrMemoryBudget is returned. The rest of the
+	// budget caches the pixels of the permutations, which are rendered again when they are
+	// needed after being evicted. When tiling, the budget also holds the pixels of the rotated
+	// tiles of the Orient mode and the masks of the placed tiles. Zero means unlimited, such that
+	// all the pixels are kept.
+	MemoryBudget int64
+	// Signatures optionally stores the signatures of the permutations, such that they are not
+	// computed again when the same tiles are permuted with the same configuration. Stored
+	// permutations are rendered only when they are needed.
+	Signatures SignatureStore
+	// Filter is the resampling filter used when scaling, shearing and rotating the tiles. Defaults
+	// to FilterBilinear.
+	Filter Filter
+}
+
+// Filter is a resampling filter for tiles transformations.
+type Filter string
+
+const (
+	// FilterNearest uses the nearest pixel. It is the fastest, and keeps pixel-art tiles crisp.
+	FilterNearest Filter = "nearest"
+	// FilterBilinear interpolates linearly between neighboring pixels.
+	FilterBilinear Filter = "bilinear"
+	// FilterCatmullRom uses the Catmull-Rom cubic kernel, which is smoother and sharper than
+	// bilinear interpolation.
+	FilterCatmullRom Filter = "catmull-rom"
+	// FilterLanczos uses the Lanczos kernel. It is the sharpest, and the slowest.
+	FilterLanczos Filter = "lanczos"
+)
+
+var filters = map[Filter]draw.Interpolator{
+	"":               draw.BiLinear,
+	FilterNearest:    draw.NearestNeighbor,
+	FilterBilinear:   draw.BiLinear,
+	FilterCatmullRom: draw.CatmullRom,
+	FilterLanczos:    imglib.Lanczos,
+}
+
+// SignatureStore stores the signatures of tiles permutations. The tiles are identified by their
+// index in the input of Permute, and the permutations configuration is identified by a key. It
+// must be safe for concurrent use.
+type SignatureStore interface {
+	// Load returns the stored signatures of the permutations of a tile, or false if there are no
+	// signatures for the given tile and key.
+	Load(tile int, key string) ([]Signature, bool)
+	// Store stores the signatures of the permutations of a tile.
+	Store(tile int, key string, signatures []Signature)
+}
+
+// Signature is the signature of a tile permutation, with the recipe to render it.
+type Signature struct {
+	// Size is the size of the permutation image.
+	Size image.Point
+	// Color and Freq are the most common color of the permutation and its frequency.
+	Color color.RGBA64
+	Freq  float64
+	// Grid is the grid signature of the permutation, of size GridSize.
+	Grid     []color.RGBA64
+	GridSize image.Point
+	// ColorIndex is the index of the color variant of the permutation, and Scale, Flip, Shear and
+	// Rotate are its geometric transformations.
+	ColorIndex int
+	Scale      float64
+	Flip       Flip
+	Shear      float64
+	Rotate     float64
+}
+
+// Flip is a mirroring of the tiles.
+type Flip string
+
+const (
+	// FlipNone keeps the tiles as is.
+	FlipNone Flip = "none"
+	// FlipHorizontal mirrors the tiles around the vertical axis.
+	FlipHorizontal Flip = "horizontal"
+	// FlipVertical mirrors the tiles around the horizontal axis.
+	FlipVertical Flip = "vertical"
+	// FlipBoth mirrors the tiles around both axes.
+	FlipBoth Flip = "both"
+)
+
+func (f Flip) axes() (horizontal, vertical bool, err error) {
+	switch f {
+	case "", FlipNone:
+		return false, false, nil
+	case FlipHorizontal:
+		return true, false, nil
+	case FlipVertical:
+		return false, true, nil
+	case FlipBoth:
+		return true, true, nil
+	default:
+		return false, false, fmt.Errorf("unknown flip %q", f)
+	}
 }
 
 // Permute returns a list of permutations of the provided images, according to the premutation
 // configuration. Permute with empty configuration returns the mode of the given images.
 func Permute(in []image.Image, cfg PermuteConfig) []mode.Mode {
+	out, _ := PermuteContext(context.Background(), in, cfg)
+	return out
+}
 
+// PermuteContext is like Permute, but can be cancelled using the given context. It returns
+// ErrNoTiles if none of the given images result in a permutation.
+func PermuteContext(ctx context.Context, in []image.Image, cfg PermuteConfig) ([]mode.Mode, error) {
+	return permute(ctx, in, cfg, imglib.NewCache(cfg.MemoryBudget))
+}
+
+// permute computes the permutations, whose pixels are held in the given cache.
+func permute(ctx context.Context, in []image.Image, cfg PermuteConfig, cache *imglib.Cache) ([]mode.Mode, error) {
 	if len(cfg.Scale) == 0 {
 		cfg.Scale = []float64{1}
 	}
 	if len(cfg.Rotate) == 0 {
 		cfg.Rotate = []float64{0}
 	}
+	if len(cfg.Flip) == 0 {
+		cfg.Flip = []Flip{FlipNone}
+	}
+	for _, f := range cfg.Flip {
+		if _, _, err := f.axes(); err != nil {
+			return nil, err
+		}
+	}
+	filter, ok := filters[cfg.Filter]
+	if !ok {
+		return nil, fmt.Errorf("unknown filter %q", cfg.Filter)
+	}
+	for _, g := range cfg.Gamma {
+		if !(g > 0) {
+			return nil, fmt.Errorf("gamma %v is not positive", g)
+		}
+	}
+	if len(cfg.Shear) == 0 {
+		cfg.Shear = []float64{0}
+	}
+	key := cfg.key()
 
 	var (
 		out    []mode.Mode
 		colors = permuteColors(cfg.NumR, cfg.NumG, cfg.NumB)
+		errs   = make(chan error, len(in))
 		wg     sync.WaitGroup
 		lock   sync.Mutex
 	)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
 	wg.Add(len(in))
-	for _, img := range in {
-		go func(img image.Image) {
+	for i, img := range in {
+		go func(i int, img image.Image) {
 			defer wg.Done()
-			perms := premuteImage(img, colors, cfg.Scale, cfg.Rotate)
+			colors := colors
+			if len(cfg.Palette) > 0 {
+				colors = paletteColors(img, cfg.Palette)
+			}
+			colors = adjustColors(colors, cfg)
+			var (
+				perms []mode.Mode
+				err   error
+			)
+			if sigs, ok := cfg.loadSignatures(i, img, key, len(colors)); ok {
+				perms, err = loadPermutations(img, sigs, colors, filter, cache, cfg)
+			} else {
+				var sigs []Signature
+				perms, sigs, err = premuteImage(ctx, img, colors, filter, cache, cfg)
+				if err == nil && ctx.Err() == nil && cfg.Signatures != nil {
+					cfg.Signatures.Store(i, key, sigs)
+				}
+			}
+			if err != nil {
+				errs <- err
+				cancel()
+				return
+			}
+			for j := range perms {
+				perms[j].Source = i
+			}
 			lock.Lock()
 			defer lock.Unlock()
 			out = append(out, perms...)
-		}(img)
+		}(i, img)
 	}
 	wg.Wait()
-	return out
+	close(errs)
+	if err := <-errs; err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return nil, ErrNoTiles
+	}
+	return out, nil
 }
 
-func premuteImage(img image.Image, colors []color.Model, scales []float64, rotations []float64) []mode.Mode {
-	if img.Bounds().Empty() {
-		return nil
+// premuteImage returns the permutations of an image and their signatures. The pixels of the
+// permutations are rendered to compute their signatures, and then kept in the cache only if its
+// budget allows it. Identical permutations are returned once, and fully transparent images have no
+// permutations.
+func premuteImage(ctx context.Context, img image.Image, colors []color.Model, filter draw.Interpolator, cache *imglib.Cache, cfg PermuteConfig) ([]mode.Mode, []Signature, error) {
+	if img == nil || img.Bounds().Empty() || imglib.Transparent(img) {
+		return nil, nil, nil
 	}
-	var perms []mode.Mode
-	for _, colorModel := range colors {
+	var (
+		perms []mode.Mode
+		sigs  []Signature
+		// seen holds the indices of the permutations by the hash of their pixels.
+		seen = make(map[uint64][]int)
+	)
+	for colorIndex, colorModel := range colors {
 		// Color the image and calculate mode.
-		img := mode.New(imglib.WithModel(img, colorModel), false)
-
-		// Generate tiles in all requested scales.
-		for _, scale := range scales {
-			img := img.Scale(scale)
-			for _, rotation := range rotations {
-				img := img.Rotate(rotation)
-				perms = append(perms, img)
+		base := mode.New(imglib.WithModel(img, colorModel), false)
+
+		// Generate tiles in all requested scales and geometric transformations.
+		for _, scale := range cfg.Scale {
+			r := recipe{src: img, color: colorModel, scale: scale, filter: filter}
+			scaled := r.scaled()
+			for _, flip := range cfg.Flip {
+				r.flip = flip
+				flipped := r.flipped(scaled)
+				for _, shear := range cfg.Shear {
+					r.shear = shear
+					sheared := r.sheared(flipped)
+					for _, rotation := range cfg.Rotate {
+						if ctx.Err() != nil {
+							return nil, nil, nil
+						}
+						r.rotation = rotation
+						rendered := r.rotated(sheared)
+						h := hash(rendered)
+						if duplicate(rendered, perms, seen[h]) {
+							continue
+						}
+						seen[h] = append(seen[h], len(perms))
+
+						perm := base
+						perm.Image = rendered
+						perm = perm.WithGrid(cfg.Grid)
+						if !cache.Reserve(signatureSize(perm)) {
+							return nil, nil, errMemoryBudget(cfg.MemoryBudget)
+						}
+						perm.Image = cache.Lazy(rendered.Rect, r.render, rendered)
+						perms = append(perms, perm)
+						sigs = append(sigs, r.signature(perm, colorIndex))
+					}
+				}
 			}
 		}
 	}
-	return perms
+	return perms, sigs, nil
+}
+
+// loadPermutations returns the permutations of an image from their stored signatures. The
+// permutations are rendered only when they are needed.
+func loadPermutations(img image.Image, sigs []Signature, colors []color.Model, filter draw.Interpolator, cache *imglib.Cache, cfg PermuteConfig) ([]mode.Mode, error) {
+	perms := make([]mode.Mode, 0, len(sigs))
+	for _, sig := range sigs {
+		r := recipe{
+			src:      img,
+			color:    colors[sig.ColorIndex],
+			scale:    sig.Scale,
+			flip:     sig.Flip,
+			shear:    sig.Shear,
+			rotation: sig.Rotate,
+			filter:   filter,
+		}
+		perm := mode.Mode{
+			Image:    cache.Lazy(image.Rectangle{Max: sig.Size}, r.render, nil),
+			Color:    sig.Color,
+			Freq:     sig.Freq,
+			GridSize: sig.GridSize,
+		}
+		for _, c := range sig.Grid {
+			perm.Grid = append(perm.Grid, c)
+		}
+		if !cache.Reserve(signatureSize(perm)) {
+			return nil, errMemoryBudget(cfg.MemoryBudget)
+		}
+		perms = append(perms, perm)
+	}
+	return perms, nil
+}
+
+// loadSignatures returns the stored signatures of a tile, if they are valid for the given number
+// of color variants and for the size of the tile image.
+func (cfg PermuteConfig) loadSignatures(tile int, img image.Image, key string, colors int) ([]Signature, bool) {
+	if cfg.Signatures == nil {
+		return nil, false
+	}
+	sigs, ok := cfg.Signatures.Load(tile, key)
+	if !ok {
+		return nil, false
+	}
+	for _, sig := range sigs {
+		if sig.ColorIndex < 0 || sig.ColorIndex >= colors {
+			return nil, false
+		}
+		if _, _, err := sig.Flip.axes(); err != nil {
+			return nil, false
+		}
+		r := recipe{src: img, scale: sig.Scale, shear: sig.Shear, rotation: sig.Rotate}
+		if r.size() != sig.Size {
+			return nil, false
+		}
+	}
+	return sigs, true
+}
+
+// key identifies the permutations that the configuration results in.
+func (cfg PermuteConfig) key() string {
+	cfg.MemoryBudget = 0
+	cfg.Signatures = nil
+	return fmt.Sprintf("%v", cfg)
+}
+
+func errMemoryBudget(budget int64) error {
+	return fmt.Errorf("%w: signatures of the permutations exceed %d bytes", ErrMemoryBudget, budget)
+}
+
+// recipe describes how a permutation is rendered from its source image.
+type recipe struct {
+	src      image.Image
+	color    color.Model
+	scale    float64
+	flip     Flip
+	shear    float64
+	rotation float64
+	filter   draw.Interpolator
+}
+
+// render returns the pixels of the permutation.
+func (r recipe) render() *image.RGBA {
+	return r.rotated(r.sheared(r.flipped(r.scaled())))
+}
+
+// size returns the size of the permutation, without rendering it.
+func (r recipe) size() image.Point {
+	size := imglib.ScaledSize(r.src.Bounds().Size(), r.scale)
+	if r.shear != 0 {
+		size = imglib.ShearedSize(size, r.shear)
+	}
+	if r.rotation != 0 {
+		size = imglib.RotatedSize(size, r.rotation)
+	}
+	return size
+}
+
+func (r recipe) scaled() *image.RGBA {
+	return imglib.Scale(imglib.WithModel(r.src, r.color), r.scale, r.filter)
+}
+
+func (r recipe) flipped(img *image.RGBA) *image.RGBA {
+	horizontal, vertical, _ := r.flip.axes()
+	if !horizontal && !vertical {
+		return img
+	}
+	return imglib.Flip(img, horizontal, vertical)
+}
+
+func (r recipe) sheared(img *image.RGBA) *image.RGBA {
+	if r.shear == 0 {
+		return img
+	}
+	return imglib.Shear(img, r.shear, r.filter)
+}
+
+func (r recipe) rotated(img *image.RGBA) *image.RGBA {
+	if r.rotation == 0 {
+		return img
+	}
+	return imglib.Rotate(img, r.rotation, r.filter)
+}
+
+// signature returns the signature of a permutation that was rendered by the recipe.
+func (r recipe) signature(m mode.Mode, colorIndex int) Signature {
+	sig := Signature{
+		Size:       m.Bounds().Size(),
+		Color:      color.RGBA64Model.Convert(m.Color).(color.RGBA64),
+		Freq:       m.Freq,
+		GridSize:   m.GridSize,
+		ColorIndex: colorIndex,
+		Scale:      r.scale,
+		Flip:       r.flip,
+		Shear:      r.shear,
+		Rotate:     r.rotation,
+	}
+	for _, c := range m.Grid {
+		sig.Grid = append(sig.Grid, color.RGBA64Model.Convert(c).(color.RGBA64))
+	}
+	return sig
+}
+
+// hash returns a hash of the pixels of an image.
+func hash(img *image.RGBA) uint64 {
+	h := fnv.New64a()
+	binary.Write(h, binary.LittleEndian, [2]int32{int32(img.Rect.Dx()), int32(img.Rect.Dy())})
+	h.Write(img.Pix)
+	return h.Sum64()
+}
+
+// duplicate returns whether the pixels are equal to the pixels of any of the permutations in the
+// given indices. The permutations are rendered again if they were evicted from the cache.
+func duplicate(img *image.RGBA, perms []mode.Mode, indices []int) bool {
+	for _, i := range indices {
+		other := imglib.Render(perms[i].Image).(*image.RGBA)
+		if other.Rect.Size() == img.Rect.Size() && bytes.Equal(other.Pix, img.Pix) {
+			return true
+		}
+	}
+	return false
+}
+
+// signatureSize estimates the number of bytes that a permutation holds regardless of its pixels:
+// its signature and its rendering recipe.
+func signatureSize(m mode.Mode) int64 {
+	return 256 + 32*int64(len(m.Grid))
 }
 
 // permuteColors returns a list of models that contains all permutations according to the
@@ -89,6 +487,62 @@ func permuteColors(nr, ng, nb uint8) []color.Model {
 	return colorModels
 }
 
+// paletteColors returns a list of models that tint the given image towards each of the palette
+// colors.
+func paletteColors(img image.Image, palette []color.Color) []color.Model {
+	if img == nil || img.Bounds().Empty() {
+		return nil
+	}
+	base := mode.New(img, false)
+	colorModels := make([]color.Model, 0, len(palette))
+	for _, c := range palette {
+		colorModels = append(colorModels, clrlib.NewShift(base.Color, c, 1))
+	}
+	return colorModels
+}
+
+// adjustColors returns the product of the given models and the hue, saturation, brightness and
+// gamma adjustments of the configuration.
+func adjustColors(colors []color.Model, cfg PermuteConfig) []color.Model {
+	chains := make([]clrlib.Chain, 0, len(colors))
+	for _, c := range colors {
+		chains = append(chains, clrlib.Chain{c})
+	}
+	chains = adjust(chains, cfg.Hue, 0, func(v float64) color.Model { return clrlib.Hue(v) })
+	chains = adjust(chains, cfg.Saturation, 1, func(v float64) color.Model { return clrlib.Saturation(v) })
+	chains = adjust(chains, cfg.Brightness, 1, func(v float64) color.Model { return clrlib.Brightness(v) })
+	chains = adjust(chains, cfg.Gamma, 1, func(v float64) color.Model { return clrlib.Gamma(v) })
+
+	colorModels := make([]color.Model, 0, len(chains))
+	for _, chain := range chains {
+		if len(chain) == 1 {
+			colorModels = append(colorModels, chain[0])
+		} else {
+			colorModels = append(colorModels, chain)
+		}
+	}
+	return colorModels
+}
+
+// adjust returns the product of the given chains and the models of the given values. A value that
+// equals identity leaves the chain unchanged.
+func adjust(chains []clrlib.Chain, values []float64, identity float64, model func(float64) color.Model) []clrlib.Chain {
+	if len(values) == 0 {
+		return chains
+	}
+	out := make([]clrlib.Chain, 0, len(chains)*len(values))
+	for _, chain := range chains {
+		for _, v := range values {
+			chain := chain
+			if v != identity {
+				chain = append(chain[:len(chain):len(chain)], model(v))
+			}
+			out = append(out, chain)
+		}
+	}
+	return out
+}
+
 // iterate returns a slice of float between [0,1] according to the number of given stpes.
 func iterate(steps uint8) []float64 {
 	if steps <= 1 {
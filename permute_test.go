@@ -1,10 +1,20 @@
 package tiler
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
 	"image/color"
+	"image/draw"
+	"math"
+	"sort"
+	"sync"
 	"testing"
 
 	"github.com/posener/tiler/internal/clrlib"
+	"github.com/posener/tiler/internal/imglib"
+	"github.com/posener/tiler/internal/mode"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -12,5 +22,286 @@ func TestPermuteColors(t *testing.T) {
 	t.Parallel()
 
 	got := permuteColors(0, 1, 2)
-	assert.Equal(t, got, []color.Model{clrlib.Scaled{1, 1, 0}, clrlib.Scaled{1, 1, 1}})
+	assert.Equal(t, got, []color.Model{clrlib.Scaled{R: 1, G: 1, B: 0}, clrlib.Scaled{R: 1, G: 1, B: 1}})
+}
+
+func TestPermutePalette(t *testing.T) {
+	t.Parallel()
+
+	tile := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	draw.Draw(tile, tile.Rect, image.NewUniform(color.White), image.ZP, draw.Src)
+	palette := []color.Color{color.RGBA{191, 0, 63, 255}, color.RGBA{0, 0, 255, 255}}
+
+	perms := Permute([]image.Image{tile}, PermuteConfig{NumR: 4, Palette: palette})
+	var got []color.Color
+	for _, perm := range perms {
+		got = append(got, perm.Color)
+	}
+	assert.ElementsMatch(t, palette, got)
+}
+
+func TestPermuteAdjust(t *testing.T) {
+	t.Parallel()
+
+	tile := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	draw.Draw(tile, tile.Rect, image.NewUniform(color.RGBA{255, 0, 0, 255}), image.ZP, draw.Src)
+
+	perms := Permute([]image.Image{tile}, PermuteConfig{Hue: []float64{0, 1.0 / 3, 2.0 / 3}})
+	var got []color.Color
+	for _, perm := range perms {
+		got = append(got, perm.Color)
+	}
+	assert.ElementsMatch(t, []color.Color{
+		color.RGBA{255, 0, 0, 255},
+		color.RGBA{0, 255, 0, 255},
+		color.RGBA{0, 0, 255, 255},
+	}, got)
+
+	tile = uniform(image.Rect(0, 0, 4, 4), color.RGBA{191, 63, 0, 255})
+	perms = Permute([]image.Image{tile}, PermuteConfig{
+		NumR:       2,
+		Hue:        []float64{0, 0.5},
+		Saturation: []float64{1, 0.5},
+		Brightness: []float64{1, 2},
+		Gamma:      []float64{1, 2},
+	})
+	assert.Len(t, perms, 2*2*2*2*2)
+
+	// Gamma must be positive.
+	for _, gamma := range []float64{0, -1, math.NaN()} {
+		_, err := PermuteContext(context.Background(), []image.Image{tile}, PermuteConfig{Gamma: []float64{1, gamma}})
+		assert.Error(t, err, "%v", gamma)
+	}
+}
+
+func TestPermuteFlipShear(t *testing.T) {
+	t.Parallel()
+
+	red, blue := color.RGBA{255, 0, 0, 255}, color.RGBA{0, 0, 255, 255}
+	tile := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	draw.Draw(tile, image.Rect(0, 0, 2, 2), image.NewUniform(red), image.ZP, draw.Src)
+	draw.Draw(tile, image.Rect(2, 0, 4, 2), image.NewUniform(blue), image.ZP, draw.Src)
+	tile.Set(0, 0, color.RGBA{0, 255, 0, 255})
+
+	perms := Permute([]image.Image{tile}, PermuteConfig{Flip: []Flip{FlipNone, FlipHorizontal, FlipBoth}})
+	if assert.Len(t, perms, 3) {
+		assert.Equal(t, color.RGBA{0, 255, 0, 255}, color.RGBAModel.Convert(perms[0].At(0, 0)))
+		assert.Equal(t, blue, color.RGBAModel.Convert(perms[1].At(0, 0)))
+		assert.Equal(t, blue, color.RGBAModel.Convert(perms[2].At(0, 1)))
+	}
+
+	perms = Permute([]image.Image{tile}, PermuteConfig{Shear: []float64{0, 1}})
+	if assert.Len(t, perms, 2) {
+		assert.Equal(t, image.Rect(0, 0, 4, 2), perms[0].Bounds())
+		assert.Equal(t, image.Rect(0, 0, 6, 2), perms[1].Bounds())
+		// The corners of a sheared tile are transparent.
+		assert.Equal(t, color.RGBA{}, color.RGBAModel.Convert(perms[1].At(5, 0)))
+		assert.Equal(t, color.RGBA{}, color.RGBAModel.Convert(perms[1].At(0, 1)))
+	}
+
+	_, err := PermuteContext(context.Background(), []image.Image{tile}, PermuteConfig{Flip: []Flip{"diagonal"}})
+	assert.Error(t, err)
+}
+
+func TestPermuteRotateBounds(t *testing.T) {
+	t.Parallel()
+
+	tile := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	draw.Draw(tile, tile.Rect, image.NewUniform(color.White), image.ZP, draw.Src)
+	draw.Draw(tile, image.Rect(0, 0, 2, 2), image.NewUniform(color.Black), image.ZP, draw.Src)
+
+	perms := Permute([]image.Image{tile}, PermuteConfig{Rotate: []float64{0, 0.25, 0.375, 0.5, 0.75}})
+	var got []image.Rectangle
+	for _, perm := range perms {
+		got = append(got, perm.Bounds())
+	}
+	assert.Equal(t, []image.Rectangle{
+		image.Rect(0, 0, 4, 2),
+		image.Rect(0, 0, 2, 4),
+		image.Rect(0, 0, 5, 5),
+		image.Rect(0, 0, 4, 2),
+		image.Rect(0, 0, 2, 4),
+	}, got)
+
+	// Rotation by half a turn covers the whole bounds.
+	assert.Equal(t, color.RGBA{255, 255, 255, 255}, color.RGBAModel.Convert(perms[3].At(0, 0)))
+	assert.Equal(t, color.RGBA{0, 0, 0, 255}, color.RGBAModel.Convert(perms[3].At(3, 1)))
+}
+
+func TestPermuteFilter(t *testing.T) {
+	t.Parallel()
+
+	red, blue := color.RGBA{255, 0, 0, 255}, color.RGBA{0, 0, 255, 255}
+	tile := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	draw.Draw(tile, image.Rect(0, 0, 2, 4), image.NewUniform(red), image.ZP, draw.Src)
+	draw.Draw(tile, image.Rect(2, 0, 4, 4), image.NewUniform(blue), image.ZP, draw.Src)
+
+	for _, filter := range []Filter{FilterNearest, FilterBilinear, FilterCatmullRom, FilterLanczos} {
+		perms := Permute([]image.Image{tile}, PermuteConfig{Scale: []float64{2}, Filter: filter})
+		if assert.Len(t, perms, 1, filter) {
+			got := color.RGBAModel.Convert(perms[0].At(3, 0))
+			if filter == FilterNearest {
+				assert.Equal(t, red, got, filter)
+			} else {
+				assert.NotEqual(t, red, got, filter)
+			}
+		}
+	}
+
+	_, err := PermuteContext(context.Background(), []image.Image{tile}, PermuteConfig{Filter: "cubic"})
+	assert.Error(t, err)
+}
+
+func TestPermuteDeduplicate(t *testing.T) {
+	t.Parallel()
+
+	tile := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	draw.Draw(tile, tile.Rect, image.NewUniform(color.White), image.ZP, draw.Src)
+
+	// A uniform square tile looks the same in all flips and in half turn rotations.
+	perms := Permute([]image.Image{tile}, PermuteConfig{
+		Flip:   []Flip{FlipNone, FlipHorizontal, FlipVertical, FlipBoth},
+		Rotate: []float64{0, 0.25, 0.5, 0.75},
+	})
+	assert.Len(t, perms, 1)
+
+	// Duplicate values and colors are deduplicated too.
+	perms = Permute([]image.Image{tile}, PermuteConfig{NumR: 2, Scale: []float64{1, 1, 0.5}})
+	assert.Len(t, perms, 4)
+}
+
+func TestDuplicate(t *testing.T) {
+	t.Parallel()
+
+	white := uniform(image.Rect(0, 0, 2, 2), color.White)
+	black := uniform(image.Rect(0, 0, 2, 2), color.Black)
+	wide := uniform(image.Rect(0, 0, 4, 1), color.White)
+	cache := imglib.NewCache(1)
+	perms := []mode.Mode{
+		{Image: white},
+		// An evicted permutation is rendered again for the comparison.
+		{Image: cache.Lazy(white.Rect, func() *image.RGBA { return uniform(white.Rect, color.White) }, nil)},
+	}
+
+	// Permutations with the same hash are compared by their pixels.
+	assert.True(t, duplicate(uniform(white.Rect, color.White), perms, []int{0}))
+	assert.True(t, duplicate(uniform(white.Rect, color.White), perms, []int{1}))
+	assert.False(t, duplicate(black, perms, []int{0, 1}))
+	assert.False(t, duplicate(wide, perms, []int{0}))
+	assert.False(t, duplicate(white, perms, nil))
+}
+
+func TestPermuteMemoryBudget(t *testing.T) {
+	t.Parallel()
+
+	tile := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	draw.Draw(tile, tile.Rect, image.NewUniform(color.White), image.ZP, draw.Src)
+	cfg := PermuteConfig{NumR: 4, NumG: 4, NumB: 4}
+
+	// The budget is too small for the signatures.
+	_, err := PermuteContext(context.Background(), []image.Image{tile}, PermuteConfig{NumR: 4, NumG: 4, NumB: 4, MemoryBudget: 1024})
+	assert.True(t, errors.Is(err, ErrMemoryBudget))
+
+	// The budget is enough for the signatures, but not for all the pixels, which are rendered again
+	// when needed.
+	cfg.MemoryBudget = 64*signatureSize(mode.Mode{}) + 2*16*16*4
+	perms, err := PermuteContext(context.Background(), []image.Image{tile}, cfg)
+	assert.NoError(t, err)
+	want := Permute([]image.Image{tile}, PermuteConfig{NumR: 4, NumG: 4, NumB: 4})
+	if assert.Len(t, perms, len(want)) {
+		for i := range want {
+			assert.Equal(t, imglib.Render(want[i].Image), imglib.Render(perms[i].Image))
+		}
+	}
+}
+
+// memStore is a SignatureStore in memory.
+type memStore struct {
+	sync.Mutex
+	sigs  map[int]map[string][]Signature
+	loads int
+}
+
+func (s *memStore) Load(tile int, key string) ([]Signature, bool) {
+	s.Lock()
+	defer s.Unlock()
+	sigs, ok := s.sigs[tile][key]
+	if ok {
+		s.loads++
+	}
+	return sigs, ok
+}
+
+func (s *memStore) Store(tile int, key string, sigs []Signature) {
+	s.Lock()
+	defer s.Unlock()
+	if s.sigs[tile] == nil {
+		s.sigs[tile] = make(map[string][]Signature)
+	}
+	s.sigs[tile][key] = sigs
+}
+
+func TestPermuteSignatures(t *testing.T) {
+	t.Parallel()
+
+	red, blue := color.RGBA{255, 0, 0, 255}, color.RGBA{0, 0, 255, 255}
+	tile := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	draw.Draw(tile, image.Rect(0, 0, 2, 4), image.NewUniform(red), image.ZP, draw.Src)
+	draw.Draw(tile, image.Rect(2, 0, 4, 4), image.NewUniform(blue), image.ZP, draw.Src)
+	tiles := []image.Image{tile, uniform(image.Rect(0, 0, 4, 4), color.White)}
+
+	store := &memStore{sigs: make(map[int]map[string][]Signature)}
+	cfg := PermuteConfig{NumR: 2, Scale: []float64{1, 0.5}, Rotate: []float64{0, 0.25}, Grid: image.Pt(2, 2), Signatures: store}
+
+	want, err := PermuteContext(context.Background(), tiles, cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, store.loads)
+	assert.Len(t, store.sigs, 2)
+
+	got, err := PermuteContext(context.Background(), tiles, cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, store.loads)
+	sortModes(want)
+	sortModes(got)
+	if assert.Len(t, got, len(want)) {
+		for i := range want {
+			assert.Equal(t, want[i].Bounds(), got[i].Bounds())
+			assert.Equal(t, color.RGBA64Model.Convert(want[i].Color), got[i].Color)
+			assert.Equal(t, want[i].Freq, got[i].Freq)
+			assert.Equal(t, want[i].GridSize, got[i].GridSize)
+			assert.Equal(t, len(want[i].Grid), len(got[i].Grid))
+			assert.Equal(t, want[i].Source, got[i].Source)
+			assert.Equal(t, imglib.Render(want[i].Image), imglib.Render(got[i].Image))
+		}
+	}
+
+	// Stored signatures of a tile whose size changed are not used.
+	resized := []image.Image{uniform(image.Rect(0, 0, 6, 6), color.White), tiles[1]}
+	got, err = PermuteContext(context.Background(), resized, cfg)
+	assert.NoError(t, err)
+	sizes := make(map[image.Point]bool)
+	for _, perm := range got {
+		if perm.Source == 0 {
+			sizes[perm.Bounds().Size()] = true
+			assert.Equal(t, imglib.Render(perm.Image).Bounds(), perm.Bounds())
+		}
+	}
+	assert.Equal(t, map[image.Point]bool{image.Pt(6, 6): true, image.Pt(3, 3): true}, sizes)
+
+	// A different configuration does not use the stored signatures.
+	loads := store.loads
+	cfg.Scale = []float64{1}
+	_, err = PermuteContext(context.Background(), tiles, cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, loads, store.loads)
+}
+
+// sortModes sorts modes by their source and their signature.
+func sortModes(modes []mode.Mode) {
+	sort.Slice(modes, func(i, j int) bool {
+		if modes[i].Source != modes[j].Source {
+			return modes[i].Source < modes[j].Source
+		}
+		return fmt.Sprint(modes[i].Bounds(), modes[i].Grid) < fmt.Sprint(modes[j].Bounds(), modes[j].Grid)
+	})
 }
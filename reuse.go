@@ -0,0 +1,115 @@
+package tiler
+
+import (
+	"image"
+	"math"
+
+	"github.com/posener/tiler/internal/mode"
+)
+
+// chooseK is the number of closest tiles that are first considered when the matched tile can't be
+// placed as is.
+const chooseK = 8
+
+// reuse tracks the placements of the tiles, and enforces the tiles reuse limits.
+type reuse struct {
+	cfg Config
+	// uses counts the placements of each source tile.
+	uses map[int]int
+	// centers holds the centers of the placements of each source tile, bucketed in cells of size
+	// RepeatDistance.
+	centers map[int]map[image.Point][]image.Point
+}
+
+func newReuse(cfg Config) *reuse {
+	return &reuse{
+		cfg:     cfg,
+		uses:    make(map[int]int),
+		centers: make(map[int]map[image.Point][]image.Point),
+	}
+}
+
+// choose returns the tile that should be placed for the given match, considering the previous
+// placements. It returns false if none of the match candidates can be placed.
+func (r *reuse) choose(m match) (mode.Mode, bool) {
+	center := centerOf(m.location)
+	if r.cfg.RepeatPenalty == 0 && r.allowed(m.tile.Source, center) {
+		return m.tile, true
+	}
+
+	// Look for the best allowed tile among the closest tiles, and widen the search if it is not
+	// closer than all the other tiles. Penalties only increase distances, so tiles that were not
+	// returned are at least as far as the farthest returned tile.
+	for k := chooseK; ; k *= 2 {
+		tiles, dists := m.index.KNearest(m.box, k)
+		var (
+			best     mode.Mode
+			bestDist = math.Inf(1)
+		)
+		for i, tile := range tiles {
+			if !r.allowed(tile.Source, center) {
+				continue
+			}
+			dist := dists[i] + r.cfg.RepeatPenalty*float64(r.uses[tile.Source])
+			if dist < bestDist {
+				best, bestDist = tile, dist
+			}
+		}
+		if len(tiles) < k || bestDist < dists[len(dists)-1] {
+			return best, !math.IsInf(bestDist, 1)
+		}
+	}
+}
+
+// use records the placement of the given match.
+func (r *reuse) use(m match) {
+	r.uses[m.tile.Source]++
+	if r.cfg.RepeatDistance > 0 {
+		center := centerOf(m.location)
+		cells := r.centers[m.tile.Source]
+		if cells == nil {
+			cells = make(map[image.Point][]image.Point)
+			r.centers[m.tile.Source] = cells
+		}
+		cell := r.cell(center)
+		cells[cell] = append(cells[cell], center)
+	}
+}
+
+// allowed returns whether a source tile can be placed in the given center.
+func (r *reuse) allowed(source int, center image.Point) bool {
+	if r.cfg.MaxUses > 0 && r.uses[source] >= r.cfg.MaxUses {
+		return false
+	}
+	cells := r.centers[source]
+	if len(cells) == 0 {
+		return true
+	}
+	// Centers that are closer than RepeatDistance are in the neighbouring cells.
+	cell := r.cell(center)
+	for dy := -1; dy <= 1; dy++ {
+		for dx := -1; dx <= 1; dx++ {
+			for _, c := range cells[cell.Add(image.Pt(dx, dy))] {
+				if dist(c, center) < r.cfg.RepeatDistance {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// cell returns the cell of the centers grid that contains the given center.
+func (r *reuse) cell(center image.Point) image.Point {
+	d := r.cfg.RepeatDistance
+	return image.Pt(int(math.Floor(float64(center.X)/d)), int(math.Floor(float64(center.Y)/d)))
+}
+
+func centerOf(r image.Rectangle) image.Point {
+	return r.Min.Add(r.Max).Div(2)
+}
+
+func dist(p1, p2 image.Point) float64 {
+	d := p1.Sub(p2)
+	return math.Hypot(float64(d.X), float64(d.Y))
+}
@@ -0,0 +1,89 @@
+package tiler
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/posener/tiler/internal/clrlib"
+	"github.com/posener/tiler/internal/index"
+	"github.com/posener/tiler/internal/mode"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReuse(t *testing.T) {
+	t.Parallel()
+
+	rect := image.Rect(0, 0, 2, 2)
+	white := mode.New(uniform(rect, color.White), false)
+	gray := mode.New(uniform(rect, color.Gray{200}), false)
+	gray.Source = 1
+	ix := index.New([]mode.Mode{white, gray}, clrlib.Distance, &clrlib.RGBSpace)
+
+	matchAt := func(x int) match {
+		return match{
+			tile:     white,
+			location: rect.Add(image.Pt(x, 0)),
+			box:      white,
+			index:    ix,
+		}
+	}
+
+	tests := []struct {
+		name string
+		cfg  Config
+		// want is the list of sources that are expected to be placed in a row of matches, -1 for
+		// no placement.
+		want []int
+	}{
+		{name: "unlimited", cfg: Config{}, want: []int{0, 0, 0}},
+		{name: "max uses", cfg: Config{MaxUses: 1}, want: []int{0, 1, -1}},
+		{name: "repeat distance", cfg: Config{RepeatDistance: 5}, want: []int{0, 1, 0, 1}},
+		{name: "repeat penalty", cfg: Config{RepeatPenalty: 0.1}, want: []int{0, 1, 0}},
+	}
+
+	for _, tt := range tests {
+		r := newReuse(tt.cfg)
+		var got []int
+		for i := range tt.want {
+			m := matchAt(i * 3)
+			tile, ok := r.choose(m)
+			if !ok {
+				got = append(got, -1)
+				continue
+			}
+			m.tile = tile
+			r.use(m)
+			got = append(got, tile.Source)
+		}
+		assert.Equal(t, tt.want, got, tt.name)
+	}
+}
+
+func TestReuseWiden(t *testing.T) {
+	t.Parallel()
+
+	rect := image.Rect(0, 0, 2, 2)
+	var tiles []mode.Mode
+	for i := 0; i < 3*chooseK; i++ {
+		tile := mode.New(uniform(rect, color.Gray{uint8(255 - i)}), false)
+		tile.Source = i
+		tiles = append(tiles, tile)
+	}
+	ix := index.New(tiles, clrlib.Distance, &clrlib.RGBSpace)
+	r := newReuse(Config{MaxUses: 1})
+
+	// The tiles are placed from the closest to the farthest, after the closest ones are used.
+	for i := range tiles {
+		m := match{tile: tiles[0], location: rect, box: tiles[0], index: ix}
+		tile, ok := r.choose(m)
+		if !assert.True(t, ok) {
+			return
+		}
+		assert.Equal(t, i, tile.Source)
+		m.tile = tile
+		r.use(m)
+	}
+	_, ok := r.choose(match{tile: tiles[0], location: rect, box: tiles[0], index: ix})
+	assert.False(t, ok)
+}
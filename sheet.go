@@ -0,0 +1,140 @@
+package tiler
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"io"
+	"sort"
+
+	"github.com/posener/tiler/internal/imglib"
+)
+
+// Sprite is a tile in a sprite sheet.
+type Sprite struct {
+	// Name identifies the sprite in the sheet.
+	Name string
+	// Rect is the area of the sprite in the sheet.
+	Rect image.Rectangle
+	// Rotated is whether the sprite is stored in the sheet rotated clockwise by 90 degrees, such
+	// that Rect is the size of the rotated sprite.
+	Rotated bool
+}
+
+// GridSprites returns the sprites of a sheet with the given bounds that is divided into cells in
+// the given size. The sprites are ordered from left to right and from top to bottom, and partial
+// cells at the right and bottom edges of the sheet are omitted.
+func GridSprites(bounds image.Rectangle, cell image.Point) ([]Sprite, error) {
+	if cell.X <= 0 || cell.Y <= 0 {
+		return nil, fmt.Errorf("invalid cell size: %v", cell)
+	}
+	var sprites []Sprite
+	for y := bounds.Min.Y; y+cell.Y <= bounds.Max.Y; y += cell.Y {
+		for x := bounds.Min.X; x+cell.X <= bounds.Max.X; x += cell.X {
+			rect := image.Rectangle{Min: image.Pt(x, y), Max: image.Pt(x, y).Add(cell)}
+			sprites = append(sprites, Sprite{Name: rect.String(), Rect: rect})
+		}
+	}
+	return sprites, nil
+}
+
+// Atlas describes the sprites of a sprite sheet.
+type Atlas struct {
+	// Image is the path of the sprite sheet, as stated in the atlas.
+	Image   string
+	Sprites []Sprite
+}
+
+// atlasFile is a TexturePacker-style JSON atlas. Frames is either an object of frames by their
+// name (JSON hash) or a list of frames (JSON array).
+type atlasFile struct {
+	Frames json.RawMessage `json:"frames"`
+	Meta   struct {
+		Image string `json:"image"`
+	} `json:"meta"`
+}
+
+type atlasFrame struct {
+	Filename string `json:"filename"`
+	Frame    struct {
+		X, Y, W, H int
+	} `json:"frame"`
+	Rotated bool `json:"rotated"`
+}
+
+// ParseAtlas parses a TexturePacker-style JSON atlas, in either the hash or the array format.
+// The sprites of a hash atlas are ordered by their names. Trimming information is ignored, such
+// that trimmed sprites result in trimmed tiles.
+func ParseAtlas(r io.Reader) (Atlas, error) {
+	var f atlasFile
+	err := json.NewDecoder(r).Decode(&f)
+	if err != nil {
+		return Atlas{}, fmt.Errorf("bad atlas: %w", err)
+	}
+
+	var frames []atlasFrame
+	if err := json.Unmarshal(f.Frames, &frames); err != nil {
+		var byName map[string]atlasFrame
+		if err := json.Unmarshal(f.Frames, &byName); err != nil {
+			return Atlas{}, fmt.Errorf("bad atlas frames: %w", err)
+		}
+		for name, frame := range byName {
+			frame.Filename = name
+			frames = append(frames, frame)
+		}
+		sort.Slice(frames, func(i, j int) bool { return frames[i].Filename < frames[j].Filename })
+	}
+
+	atlas := Atlas{Image: f.Meta.Image}
+	for _, frame := range frames {
+		size := image.Pt(frame.Frame.W, frame.Frame.H)
+		if frame.Rotated {
+			// The frame size is the size of the sprite before it was rotated into the sheet.
+			size = image.Pt(size.Y, size.X)
+		}
+		min := image.Pt(frame.Frame.X, frame.Frame.Y)
+		atlas.Sprites = append(atlas.Sprites, Sprite{
+			Name:    frame.Filename,
+			Rect:    image.Rectangle{Min: min, Max: min.Add(size)},
+			Rotated: frame.Rotated,
+		})
+	}
+	return atlas, nil
+}
+
+// SliceSheet slices the given sprites from a sprite sheet into tiles. If dropTransparent is set,
+// sprites that are fully transparent are dropped. It returns the sprites that were not dropped
+// and their tiles, in the same order.
+func SliceSheet(sheet image.Image, sprites []Sprite, dropTransparent bool) ([]Sprite, []image.Image) {
+	var (
+		kept  []Sprite
+		tiles []image.Image
+	)
+	for _, sprite := range sprites {
+		if sprite.Rect.Intersect(sheet.Bounds()).Empty() {
+			continue
+		}
+		tile := imglib.SubImage(sheet, sprite.Rect)
+		if dropTransparent && imglib.Transparent(tile) {
+			continue
+		}
+		if sprite.Rotated {
+			tile = unrotate(tile)
+		}
+		kept = append(kept, sprite)
+		tiles = append(tiles, tile)
+	}
+	return kept, tiles
+}
+
+// unrotate rotates a sprite counterclockwise by 90 degrees.
+func unrotate(img image.Image) image.Image {
+	r := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, r.Dy(), r.Dx()))
+	for x := 0; x < r.Dy(); x++ {
+		for y := 0; y < r.Dx(); y++ {
+			dst.Set(x, y, img.At(r.Min.X+r.Dx()-1-y, r.Min.Y+x))
+		}
+	}
+	return dst
+}
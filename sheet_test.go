@@ -0,0 +1,94 @@
+package tiler
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGridSprites(t *testing.T) {
+	t.Parallel()
+
+	// A 5x3 sheet of 2x2 cells, the last column and row are partial.
+	sheet := image.NewRGBA(image.Rect(0, 0, 5, 3))
+	red := color.RGBA{255, 0, 0, 255}
+	sheet.Set(0, 0, red)
+	sheet.Set(3, 1, red)
+
+	sprites, err := GridSprites(sheet.Bounds(), image.Pt(2, 2))
+	assert.NoError(t, err)
+	assert.Equal(t, []Sprite{
+		{Name: "(0,0)-(2,2)", Rect: image.Rect(0, 0, 2, 2)},
+		{Name: "(2,0)-(4,2)", Rect: image.Rect(2, 0, 4, 2)},
+	}, sprites)
+
+	kept, tiles := SliceSheet(sheet, sprites, false)
+	assert.Equal(t, sprites, kept)
+	if assert.Len(t, tiles, 2) {
+		assert.Equal(t, image.Rect(2, 0, 4, 2), tiles[1].Bounds())
+		assert.Equal(t, red, tiles[1].At(3, 1))
+	}
+
+	// Drop the transparent cell.
+	sheet.Set(3, 1, color.RGBA{})
+	kept, tiles = SliceSheet(sheet, sprites, true)
+	assert.Equal(t, sprites[:1], kept)
+	assert.Len(t, tiles, 1)
+
+	_, err = GridSprites(sheet.Bounds(), image.Pt(0, 2))
+	assert.Error(t, err)
+}
+
+func TestParseAtlas(t *testing.T) {
+	t.Parallel()
+
+	hash := `{
+		"frames": {
+			"b.png": {"frame": {"x": 0, "y": 2, "w": 3, "h": 1}, "rotated": true},
+			"a.png": {"frame": {"x": 1, "y": 0, "w": 2, "h": 2}, "rotated": false}
+		},
+		"meta": {"image": "sheet.png"}
+	}`
+	array := `{
+		"frames": [
+			{"filename": "a.png", "frame": {"x": 1, "y": 0, "w": 2, "h": 2}},
+			{"filename": "b.png", "frame": {"x": 0, "y": 2, "w": 3, "h": 1}, "rotated": true}
+		],
+		"meta": {"image": "sheet.png"}
+	}`
+	want := Atlas{
+		Image: "sheet.png",
+		Sprites: []Sprite{
+			{Name: "a.png", Rect: image.Rect(1, 0, 3, 2)},
+			{Name: "b.png", Rect: image.Rect(0, 2, 1, 5), Rotated: true},
+		},
+	}
+
+	for _, data := range []string{hash, array} {
+		atlas, err := ParseAtlas(strings.NewReader(data))
+		assert.NoError(t, err)
+		assert.Equal(t, want, atlas)
+	}
+
+	_, err := ParseAtlas(strings.NewReader(`{"frames": 1}`))
+	assert.Error(t, err)
+}
+
+func TestSliceSheetRotated(t *testing.T) {
+	t.Parallel()
+
+	// A 3x1 sprite stored rotated clockwise as a 1x3 column: its first pixel is at the top.
+	sheet := image.NewRGBA(image.Rect(0, 0, 1, 3))
+	red := color.RGBA{255, 0, 0, 255}
+	sheet.Set(0, 0, red)
+
+	_, tiles := SliceSheet(sheet, []Sprite{{Rect: sheet.Bounds(), Rotated: true}}, false)
+	if assert.Len(t, tiles, 1) {
+		assert.Equal(t, image.Rect(0, 0, 3, 1), tiles[0].Bounds())
+		assert.Equal(t, red, tiles[0].At(0, 0))
+		assert.Equal(t, color.RGBA{}, tiles[0].At(2, 0))
+	}
+}
@@ -3,16 +3,31 @@
 package tiler
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"image"
-	"image/draw"
+	"image/color"
 	"log"
+	"math"
 	"sort"
 	"sync"
 
+	"github.com/posener/tiler/internal/clrlib"
 	"github.com/posener/tiler/internal/imglib"
+	"github.com/posener/tiler/internal/index"
 	"github.com/posener/tiler/internal/mode"
 )
 
+var (
+	// ErrNoTiles is returned when there are no non-empty tiles to tile with.
+	ErrNoTiles = errors.New("no tiles")
+	// ErrEmptyImage is returned when the image to tile has no pixels.
+	ErrEmptyImage = errors.New("empty image")
+	// ErrMemoryBudget is returned when the tiles permutations do not fit in the memory budget.
+	ErrMemoryBudget = errors.New("memory budget exceeded")
+)
+
 // Config is the configration of the tiling process.
 type Config struct {
 	// Shift defines the location for which matching the tile will happen. The given (x,y) result in
@@ -23,55 +38,353 @@ type Config struct {
 	Overlap bool
 	// TilesPermute is the configuration of the tiles permutations.
 	TilesPermute PermuteConfig
+	// Metric is the color distance metric used for matching tiles. Defaults to MetricRGB. The
+	// MetricRGB and MetricCIE76 matching uses an index of the tiles, while the other metrics fall
+	// back to a linear scan over the tiles of each size, which is slower for many tiles.
+	Metric Metric
+	// MaxUses limits the number of times that each of the given tiles can be placed, in all its
+	// permutations. Zero means unlimited.
+	MaxUses int
+	// RepeatDistance is the minimal distance, in pixels, between the centers of two placements
+	// of the same tile. Zero means no limit.
+	RepeatDistance float64
+	// RepeatPenalty is added to the distance of a tile from an image box for every previous
+	// placement of that tile, to encourage variety of the placed tiles. It must not be negative.
+	RepeatPenalty float64
+	// Layout defines how the image is divided into boxes that are matched with tiles. Defaults to
+	// LayoutGrid.
+	Layout Layout
+	// QuadtreeThreshold is the color variance in range [0..1] above which a region is subdivided
+	// in the LayoutQuadtree layout. The variance is the sum of the variances of the color
+	// components of the region.
+	QuadtreeThreshold float64
+	// PoissonSpacing is the minimal distance between the centers of boxes in the LayoutPoisson
+	// layout, relative to the tile size. Smaller values result in denser layouts. Defaults to 1.
+	PoissonSpacing float64
+	// Seed is the seed for random layouts.
+	Seed int64
+	// FillGaps fills areas that were not covered by tiles in a second pass, using progressively
+	// smaller tiles. It is applicable only when Overlap is false.
+	FillGaps bool
+	// GapColor fills areas that were not covered by tiles with the mean color of the image around
+	// them. It is applied after FillGaps, and is applicable only when Overlap is false.
+	GapColor bool
+	// Background is drawn before the tiles are placed. Defaults to a transparent background.
+	Background Background
+	// PaletteSize is the number of colors of a palette that is extracted from the image, and
+	// used for the tiles color permutations instead of the TilesPermute color configuration.
+	// Zero means no palette.
+	PaletteSize int
+	// Tint recolors each tile as it is placed, such that its most common color is the most common
+	// color of the image box it is placed on. When set, the tiles are matched by their shape, and
+	// the color permutations of TilesPermute are not used. Tinted tiles are matched by a linear
+	// scan over the tiles of each size, and not by an index. Tint already sets the color of the
+	// tiles, so it can't be used with the BlendColor and BlendLuminance modes of Blend.
+	Tint bool
+	// Blend blends the tiles with the original image. Defaults to no blending.
+	Blend Blend
+	// Grid is the size (columns, rows) of a grid of mean colors that is used as the signature of
+	// the tiles and of the image boxes, in order to match their spatial structure. If empty, only
+	// the most common color is used for matching. Grid signatures are matched by a linear scan over
+	// the tiles of each size, and not by an index.
+	Grid image.Point
+	// Orient rotates each placed tile to follow the dominant edge direction of the image box it is
+	// placed on, which is estimated from the structure tensor of the box. The tile is matched
+	// before it is rotated, and the rotation uses the resampling filter of TilesPermute.
+	Orient bool
+	// OrientThreshold is the minimal coherence in range [0..1] of the edge direction of an image
+	// box, under which tiles are not rotated in the Orient mode. Zero rotates tiles on any box
+	// that has an edge direction.
+	OrientThreshold float64
+	// FrameStability keeps tiles stable between the frames of an animation in TileGIF. A tile
+	// that was matched to a location in the previous frame is kept if its distance from the
+	// location in the current frame exceeds the distance of the closest tile by at most this
+	// value. Zero keeps previous tiles only if they are still the closest.
+	FrameStability float64
+	// Placed is called for every tile that is placed on the output, in the order of placement. It
+	// can be used to render the result in other forms, such as text.
+	Placed func(Placement)
+	// Logf is used to report the tiling progress. If nil, the standard logger is used.
+	Logf func(format string, args ...interface{})
+}
+
+// Metric is a color distance metric.
+type Metric string
+
+// Available color distance metrics.
+const (
+	// MetricRGB is the euclidean distance in the RGB color space.
+	MetricRGB Metric = "rgb"
+	// MetricCIE76 is the euclidean distance in the CIELAB color space.
+	MetricCIE76 Metric = "cie76"
+	// MetricCIE94 is the CIE 1994 color difference.
+	MetricCIE94 Metric = "cie94"
+	// MetricCIEDE2000 is the CIE 2000 color difference.
+	MetricCIEDE2000 Metric = "ciede2000"
+)
+
+// metricFuncs holds the implementation of a metric.
+type metricFuncs struct {
+	distance clrlib.DistanceFunc
+	// space enables indexing of the tiles colors. It is nil for metrics that can't be indexed.
+	space *clrlib.Space
+}
+
+var metrics = map[Metric]metricFuncs{
+	"":              {distance: clrlib.Distance, space: &clrlib.RGBSpace},
+	MetricRGB:       {distance: clrlib.Distance, space: &clrlib.RGBSpace},
+	MetricCIE76:     {distance: clrlib.CIE76, space: &clrlib.LabSpace},
+	MetricCIE94:     {distance: clrlib.CIE94},
+	MetricCIEDE2000: {distance: clrlib.CIEDE2000},
 }
 
 // UpdateFn is a function for updating on any change to the given image.
 type UpdateFn func(img image.Image)
 
+// Placement describes a tile that was placed on the output.
+type Placement struct {
+	// Source is the index of the placed tile in the given tiles.
+	Source int
+	// Rect is the area of the output that the tile was placed on.
+	Rect image.Rectangle
+	// Color is the most common color of the image area that the tile was matched to.
+	Color color.Color
+}
+
 // Tile matches the given tiles with the given configuration over the given image. The tiled image
-// is returned in the output.
+// is returned in the output. If tiling fails, the error is logged and a transparent image in the
+// bounds of the given image is returned, use TileContext to get the error instead.
 func Tile(img image.Image, tiles []image.Image, cfg Config, update UpdateFn) image.Image {
-	log.Printf("Computing tiles permutations...")
-	perms := Permute(tiles, cfg.TilesPermute)
-	log.Printf("Using %d tiles permutations!", len(perms))
+	out, err := TileContext(context.Background(), img, tiles, cfg, update)
+	if err != nil {
+		cfg.logf()("Failed tiling: %s", err)
+		var rect image.Rectangle
+		if img != nil {
+			rect = img.Bounds()
+		}
+		return image.NewRGBA(rect)
+	}
+	return out
+}
+
+// TileContext is like Tile, but can be cancelled using the given context. It returns an error if
+// the context is done before the tiling is completed, or if the given input can't be tiled.
+func TileContext(ctx context.Context, img image.Image, tiles []image.Image, cfg Config, update UpdateFn) (image.Image, error) {
+	if img == nil || img.Bounds().Empty() {
+		return nil, ErrEmptyImage
+	}
+	t, err := newTiling(ctx, img, tiles, cfg)
+	if err != nil {
+		return nil, err
+	}
+	out, _, err := t.tile(ctx, img, nil, update)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// tiling holds the tiles permutations, such that they are computed once for tiling several
+// images.
+type tiling struct {
+	cfg    Config
+	metric metricFuncs
+	groups []tileGroup
+	// cache holds the pixels of the tiles permutations, and other tile data of the canvas, within
+	// the memory budget of TilesPermute.
+	cache *imglib.Cache
+	logf  func(format string, args ...interface{})
+}
+
+// newTiling validates the configuration and computes the tiles permutations. The image is used
+// for configurations that are derived from the tiled image, such as the palette.
+func newTiling(ctx context.Context, img image.Image, tiles []image.Image, cfg Config) (*tiling, error) {
+	metric, ok := metrics[cfg.Metric]
+	if !ok {
+		return nil, fmt.Errorf("unknown metric %q", cfg.Metric)
+	}
+	if _, ok := layouts[cfg.Layout]; !ok {
+		return nil, fmt.Errorf("unknown layout %q", cfg.Layout)
+	}
+	if err := cfg.Blend.validate(); err != nil {
+		return nil, err
+	}
+	if cfg.Tint && (cfg.Blend.Mode == BlendColor || cfg.Blend.Mode == BlendLuminance) {
+		return nil, fmt.Errorf("blend mode %q can't be used with tint", cfg.Blend.Mode)
+	}
+	if cfg.RepeatPenalty < 0 {
+		return nil, fmt.Errorf("negative repeat penalty %v", cfg.RepeatPenalty)
+	}
+	logf := cfg.logf()
+
+	logf("Computing tiles permutations...")
+	permuteCfg := cfg.PermuteConfig(img)
+	if len(permuteCfg.Palette) > 0 {
+		logf("Extracted a palette of %d colors", len(permuteCfg.Palette))
+	}
+	cache := imglib.NewCache(permuteCfg.MemoryBudget)
+	perms, err := permute(ctx, tiles, permuteCfg, cache)
+	if err != nil {
+		return nil, err
+	}
+	logf("Using %d tiles permutations!", len(perms))
+
+	return &tiling{
+		cfg:    cfg,
+		metric: metric,
+		groups: groupTiles(perms, cfg, metric),
+		cache:  cache,
+		logf:   logf,
+	}, nil
+}
+
+// tile tiles an image. If prev is not nil, it holds the tiles that were matched to locations of a
+// previous frame, which are kept according to the FrameStability configuration. It returns the
+// tiled image and the tiles that were matched to each location.
+func (t *tiling) tile(ctx context.Context, img image.Image, prev map[image.Rectangle]mode.Mode, update UpdateFn) (*image.RGBA, map[image.Rectangle]mode.Mode, error) {
+	if update == nil {
+		update = func(image.Image) {}
+	}
+	cfg, logf := t.cfg, t.logf
+
+	logf("Computing tiles matches...")
+	matches, err := computeMatches(ctx, img, t.groups, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	if prev != nil {
+		stabilize(matches, prev, cfg, t.metric)
+	}
+	logf("Computed tiles matching in %d locations", len(matches))
+	matched := make(map[image.Rectangle]mode.Mode, len(matches))
+	for _, m := range matches {
+		matched[m.location] = m.tile
+	}
+
+	logf("Composing output...")
+	c := newCanvas(img.Bounds(), cfg, t.cache, update)
+	defer c.release()
+	err = cfg.Background.draw(c.RGBA, img)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = composeMatches(ctx, c, matches, logf)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	log.Printf("Computing tiles matches...")
-	matches := computeMatches(img, perms, cfg.Shift)
-	log.Printf("Computed tiles matching in %d locations", len(matches))
+	if !cfg.Overlap && (cfg.FillGaps || cfg.GapColor) {
+		logf("Coverage before filling gaps: %.1f%%", 100*c.coverage(img))
+		err = fillGaps(ctx, img, c, t.groups, logf)
+		if err != nil {
+			return nil, nil, err
+		}
+		logf("Coverage after filling gaps: %.1f%%", 100*c.coverage(img))
+	}
+
+	cfg.Blend.overlay(c.RGBA, img)
+	update(c.RGBA)
+	return c.RGBA, matched, nil
+}
 
-	log.Print("Composing output...")
-	return composeMatches(img.Bounds(), matches, cfg.Overlap, update)
+// PermuteConfig returns the configuration with which the tiles are permuted for tiling the given
+// image. It is TilesPermute, adjusted to the rest of the configuration.
+func (cfg Config) PermuteConfig(img image.Image) PermuteConfig {
+	permuteCfg := cfg.TilesPermute
+	permuteCfg.Grid = cfg.Grid
+	switch {
+	case cfg.Tint:
+		// Tiles are recolored when placed, there is no need for color permutations.
+		permuteCfg.NumR, permuteCfg.NumG, permuteCfg.NumB = 0, 0, 0
+		permuteCfg.Palette = nil
+		permuteCfg.Hue, permuteCfg.Saturation, permuteCfg.Brightness, permuteCfg.Gamma = nil, nil, nil, nil
+	case cfg.PaletteSize > 0:
+		permuteCfg.Palette = mode.Palette(img, cfg.PaletteSize)
+	}
+	return permuteCfg
+}
+
+func (c Config) logf() func(format string, args ...interface{}) {
+	if c.Logf != nil {
+		return c.Logf
+	}
+	return log.Printf
 }
 
 // match represetns matching of a tile to a location in the image.
 type match struct {
 	// which tiled is matched.
-	tile image.Image
+	tile mode.Mode
 	// to which area in the original image is it being matched.
 	location image.Rectangle
 	// how far is it from the original image area.
 	distance float64
+	// the mode of the original image area.
+	box mode.Mode
+	// the shape of the image area in masked layouts, or nil. The pixel p of the image is in the
+	// shape if the pixel p+shapeOffset of the shape is not transparent.
+	shape       image.Image
+	shapeOffset image.Point
+	// the index of all the tiles that could be matched to the location.
+	index *index.Index
+	// the rotation of the tile when it is placed, in range [0..1].
+	rotation float64
 }
 
-// intersect checks if the match's tile intersects with a corresponding patch in the given image.
-// It is used to check if a new tile overlaps existing drawn image.
-func (m match) intersect(img *image.RGBA) bool {
-	patch := img.SubImage(m.location).(*image.RGBA)
-	// Move the rect of the path to the origin.
-	patch.Rect = patch.Rect.Sub(m.location.Min)
-	return imglib.Intersect(patch, m.tile)
+// tileGroup is a group of tiles of the same size.
+type tileGroup struct {
+	size  image.Point
+	tiles []mode.Mode
+	index *index.Index
 }
 
-// computeMatches computes a 'match' for each tile, according to the distance from boxes
-// defined over the image.
-func computeMatches(img image.Image, tiles []mode.Mode, shift image.Point) []match {
-	// Map tiles according to their size, to improve performance: This result in gridding the image
-	// only once, and test all tiles with the same size against the same grid.
+// groupTiles groups the tiles according to their size, to improve performance: This result in
+// gridding the image only once, and test all tiles with the same size against the same grid. The
+// groups are sorted from the largest to the smallest tiles.
+func groupTiles(tiles []mode.Mode, cfg Config, metric metricFuncs) []tileGroup {
 	mapped := make(map[image.Point][]mode.Mode)
 	for _, tile := range tiles {
 		size := tile.Bounds().Size()
 		mapped[size] = append(mapped[size], tile)
 	}
+	groups := make([]tileGroup, 0, len(mapped))
+	for size, sizeTiles := range mapped {
+		groups = append(groups, tileGroup{size: size, tiles: sizeTiles})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return imglib.Area(image.Rectangle{Max: groups[i].size}) > imglib.Area(image.Rectangle{Max: groups[j].size})
+	})
+
+	// Compute the grid signatures of the tiles once, and index them before matching.
+	var wg sync.WaitGroup
+	wg.Add(len(groups))
+	for i := range groups {
+		go func(g *tileGroup) {
+			defer wg.Done()
+			for j := range g.tiles {
+				if g.tiles[j].GridSize != cfg.Grid {
+					g.tiles[j] = g.tiles[j].WithGrid(cfg.Grid)
+				}
+			}
+			if cfg.Tint {
+				g.index = index.NewTinted(g.tiles, metric.distance)
+			} else {
+				g.index = index.New(g.tiles, metric.distance, metric.space)
+			}
+		}(&groups[i])
+	}
+	wg.Wait()
+	return groups
+}
+
+// computeMatches computes a 'match' for each tile, according to the distance from boxes
+// defined over the image.
+func computeMatches(ctx context.Context, img image.Image, groups []tileGroup, cfg Config) ([]match, error) {
+	sizes := make([]image.Point, 0, len(groups))
+	for _, g := range groups {
+		sizes = append(sizes, g.size)
+	}
+	boxes := layouts[cfg.Layout](img, sizes, cfg)
 
 	var (
 		matches []match
@@ -80,52 +393,79 @@ func computeMatches(img image.Image, tiles []mode.Mode, shift image.Point) []mat
 	)
 
 	// Compute for all the tiles.
-	wg.Add(len(mapped))
-	for size := range mapped {
-		go func(size image.Point) {
+	wg.Add(len(groups))
+	for _, g := range groups {
+		go func(g tileGroup) {
 			defer wg.Done()
 
 			// Compute for each box (a sub image of the original image) of the
-			// current tile size, with the required shift.
+			// current tile size.
 			var sizeMatches []match
-			for _, box := range grid(img, size, shift) {
-				boxMode := mode.New(box, true)
-				tile, dist := closestMode(boxMode, mapped[size])
-				if tile == nil {
+			for _, box := range boxes[g.size] {
+				if ctx.Err() != nil {
+					return
+				}
+				m, ok := g.match(box, cfg)
+				if !ok {
 					continue
 				}
-				sizeMatches = append(sizeMatches,
-					match{tile: tile, location: box.Bounds(), distance: dist})
+				sizeMatches = append(sizeMatches, m)
 			}
 
 			// Add the matches from the current size to all the matches.
 			lock.Lock()
 			defer lock.Unlock()
 			matches = append(matches, sizeMatches...)
-		}(size)
+		}(g)
 	}
 	wg.Wait()
-	return matches
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return matches, nil
+}
+
+// match matches a box of the image with the closest tile in the group. It returns false if there
+// is no match.
+func (g tileGroup) match(box image.Image, cfg Config) (match, bool) {
+	boxMode := mode.New(box, true).WithGrid(cfg.Grid)
+	tile, dist, ok := g.index.Nearest(boxMode)
+	if !ok {
+		return match{}, false
+	}
+	m := match{
+		tile:     tile,
+		location: box.Bounds(),
+		distance: dist,
+		box:      boxMode,
+		index:    g.index,
+	}
+	m.shape, m.shapeOffset = imglib.MaskOf(box)
+	if cfg.Orient {
+		angle, coherence := imglib.Orientation(box)
+		if coherence > cfg.OrientThreshold {
+			m.rotation = angle / (2 * math.Pi)
+		}
+	}
+	return m, true
 }
 
 // composeMatches places the matches over the canvas. It places them in two modes:
 // * No overlap: The ones that are closest (smallest distances to image box) and largest are placed
 //   first, then other are placed with no overlap.
 // * With overlap: All the matches are placed, starting from the most distant and largest.
-func composeMatches(rect image.Rectangle, matches []match, overlap bool, update UpdateFn) image.Image {
-	log.Printf("Sorting matches...")
-	sort.Slice(matches, func(i, j int) bool { return less(matches[i], matches[j], overlap) })
+func composeMatches(ctx context.Context, c *canvas, matches []match, logf func(string, ...interface{})) error {
+	logf("Sorting matches...")
+	sort.Slice(matches, func(i, j int) bool { return less(matches[i], matches[j], c.cfg.Overlap) })
 
-	log.Printf("Placing matches...")
-	out := image.NewRGBA(rect)
+	logf("Placing matches...")
 	for _, match := range matches {
-		if !overlap && match.intersect(out) {
-			continue
+		if err := ctx.Err(); err != nil {
+			return err
 		}
-		draw.Draw(out, match.location, match.tile, image.ZP, draw.Over)
-		update(out)
+		c.place(match)
 	}
-	return out
+	return nil
 }
 
 func less(left, right match, overlap bool) bool {
@@ -139,35 +479,3 @@ func less(left, right match, overlap bool) bool {
 	return ret
 
 }
-
-// grid returns a list of subimages of the given image according to the given
-// grid size and shift.
-func grid(img image.Image, size, shift image.Point) []image.Image {
-	if shift.Eq(image.ZP) {
-		shift = size
-	}
-	var boxes []image.Image
-	for i := imglib.Iterate(img.Bounds(), &shift); i.Next(); {
-		boxes = append(boxes, imglib.SubImage(img, image.Rectangle{Min: i.Point, Max: i.Add(size)}))
-	}
-	return boxes
-}
-
-// closestMode returns the image closes mode and its distances.
-func closestMode(m mode.Mode, others []mode.Mode) (image.Image, float64) {
-	// if the mode is transparent, return no match.
-	if _, _, _, a := m.RGBA(); a == 0 {
-		return nil, 0
-	}
-
-	minMode := others[0]
-	minDist := float64(1)
-	for _, other := range others {
-		dist := m.Distance(other)
-		if dist < minDist {
-			minDist = dist
-			minMode = other
-		}
-	}
-	return minMode, minDist
-}
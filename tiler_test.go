@@ -0,0 +1,284 @@
+package tiler
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/png"
+	"os"
+	"testing"
+
+	"github.com/posener/tiler/internal/clrlib"
+	"github.com/posener/tiler/internal/imglib"
+	"github.com/posener/tiler/internal/index"
+	"github.com/posener/tiler/internal/mode"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTileContext(t *testing.T) {
+	t.Parallel()
+
+	img := uniform(image.Rect(0, 0, 10, 10), color.White)
+	tile := uniform(image.Rect(0, 0, 2, 2), color.Black)
+
+	out, err := TileContext(context.Background(), img, []image.Image{tile}, Config{}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, img.Bounds(), out.Bounds())
+
+	_, err = TileContext(context.Background(), img, nil, Config{}, nil)
+	assert.Equal(t, ErrNoTiles, err)
+
+	_, err = TileContext(context.Background(), img, []image.Image{&image.RGBA{}}, Config{}, nil)
+	assert.Equal(t, ErrNoTiles, err)
+
+	_, err = TileContext(context.Background(), img, []image.Image{image.NewRGBA(tile.Bounds())}, Config{}, nil)
+	assert.Equal(t, ErrNoTiles, err)
+
+	_, err = TileContext(context.Background(), &image.RGBA{}, []image.Image{tile}, Config{}, nil)
+	assert.Equal(t, ErrEmptyImage, err)
+
+	_, err = TileContext(context.Background(), img, []image.Image{tile}, Config{Metric: "foo"}, nil)
+	assert.Error(t, err)
+
+	for _, metric := range []Metric{MetricRGB, MetricCIE76, MetricCIE94, MetricCIEDE2000} {
+		_, err = TileContext(context.Background(), img, []image.Image{tile}, Config{Metric: metric}, nil)
+		assert.NoError(t, err, metric)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = TileContext(ctx, img, []image.Image{tile}, Config{}, nil)
+	assert.Equal(t, context.Canceled, err)
+	// Tile does not fail on bad input, and returns a transparent image instead.
+	noLog := Config{Logf: func(string, ...interface{}) {}}
+	assert.NotNil(t, Tile(img, []image.Image{tile}, noLog, nil))
+	assert.Equal(t, image.NewRGBA(img.Bounds()), Tile(img, nil, noLog, nil))
+	assert.Equal(t, image.NewRGBA(image.Rectangle{}), Tile(&image.RGBA{}, []image.Image{tile}, noLog, nil))
+	assert.Equal(t, image.NewRGBA(image.Rectangle{}), Tile(nil, []image.Image{tile}, noLog, nil))
+}
+
+func uniform(rect image.Rectangle, c color.Color) *image.RGBA {
+	img := image.NewRGBA(rect)
+	draw.Draw(img, rect, image.NewUniform(c), image.ZP, draw.Src)
+	return img
+}
+
+func TestNearestGrid(t *testing.T) {
+	t.Parallel()
+
+	red := color.RGBA{255, 0, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+	split := func(left, right color.Color) image.Image {
+		img := uniform(image.Rect(0, 0, 4, 4), left)
+		draw.Draw(img, image.Rect(2, 0, 4, 4), image.NewUniform(right), image.ZP, draw.Src)
+		return img
+	}
+
+	box := mode.New(split(red, blue), false).WithGrid(image.Pt(2, 1))
+	tiles := []mode.Mode{
+		mode.New(uniform(image.Rect(0, 0, 4, 4), red), false).WithGrid(image.Pt(2, 1)),
+		mode.New(split(blue, red), false).WithGrid(image.Pt(2, 1)),
+		mode.New(split(red, blue), false).WithGrid(image.Pt(2, 1)),
+	}
+
+	got, dist, ok := index.New(tiles, clrlib.Distance, &clrlib.RGBSpace).Nearest(box)
+	assert.True(t, ok)
+	assert.Equal(t, tiles[2], got)
+	assert.Equal(t, 0.0, dist)
+}
+
+// BenchmarkNearest compares the nearest tile lookup with and without an index, using the
+// configurations from gallery/make.sh. The gallery input images are not in the repository, so the
+// gallery images are used instead. Lookups are benchmarked on an even sample of the boxes of each
+// tile size, since computing the modes of all the boxes of a 1,1 shift takes too long.
+func BenchmarkNearest(b *testing.B) {
+	const maxBoxes = 1000
+	tile := loadImage(b, "testdata/circle.png")
+
+	configs := []struct {
+		name  string
+		img   string
+		shift image.Point
+		cfg   PermuteConfig
+	}{
+		{
+			name:  "cake",
+			img:   "gallery/cake.png",
+			shift: image.Pt(1, 1),
+			cfg:   PermuteConfig{NumR: 8, NumG: 8, NumB: 8, Scale: []float64{1, 0.8, 0.6, 0.4, 0.2}},
+		},
+		{
+			name: "starry-night",
+			img:  "gallery/starry-night.png",
+			cfg:  PermuteConfig{NumR: 16, NumG: 16, NumB: 16, Scale: []float64{0.1}},
+		},
+		{
+			name:  "starry-night-shift-1",
+			img:   "gallery/starry-night.png",
+			shift: image.Pt(1, 1),
+			cfg:   PermuteConfig{NumR: 4, NumG: 4, NumB: 4, Scale: []float64{0.1}},
+		},
+	}
+
+	for _, config := range configs {
+		img := loadImage(b, config.img)
+		perms := Permute([]image.Image{tile}, config.cfg)
+		sizes := make(map[image.Point][]mode.Mode)
+		for _, perm := range perms {
+			sizes[perm.Bounds().Size()] = append(sizes[perm.Bounds().Size()], perm)
+		}
+
+		var linear, indexed []lookup
+		for size, tiles := range sizes {
+			linearIndex := index.New(tiles, clrlib.Distance, nil)
+			index := index.New(tiles, clrlib.Distance, &clrlib.RGBSpace)
+			boxes := grid(img, size, config.shift)
+			step := (len(boxes) + maxBoxes - 1) / maxBoxes
+			for i := 0; i < len(boxes); i += step {
+				box := mode.New(boxes[i], true)
+				linear = append(linear, lookup{index: linearIndex, box: box})
+				indexed = append(indexed, lookup{index: index, box: box})
+			}
+		}
+
+		b.Run(config.name+"/linear", func(b *testing.B) { benchmarkNearest(b, linear) })
+		b.Run(config.name+"/index", func(b *testing.B) { benchmarkNearest(b, indexed) })
+	}
+}
+
+// lookup is a lookup of the nearest tile to a box.
+type lookup struct {
+	index *index.Index
+	box   mode.Mode
+}
+
+func benchmarkNearest(b *testing.B, lookups []lookup) {
+	for i := 0; i < b.N; i++ {
+		l := lookups[i%len(lookups)]
+		l.index.Nearest(l.box)
+	}
+}
+
+func loadImage(b *testing.B, path string) image.Image {
+	b.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return img
+}
+
+func TestComposeMatchesNoOverlap(t *testing.T) {
+	t.Parallel()
+
+	// A tile which is opaque only in its left half.
+	tile := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	draw.Draw(tile, image.Rect(0, 0, 2, 4), image.NewUniform(color.Black), image.ZP, draw.Src)
+	m := mode.New(tile, false)
+
+	matches := []match{
+		{tile: m, location: image.Rect(0, 0, 4, 4), distance: 0.1},
+		// Overlaps only with the transparent half of the first tile.
+		{tile: m, location: image.Rect(2, 0, 6, 4), distance: 0.2},
+		// Overlaps with the opaque half of the second tile.
+		{tile: m, location: image.Rect(3, 0, 7, 4), distance: 0.3},
+	}
+	logf := func(string, ...interface{}) {}
+
+	// The masks of the tiles are kept only if they fit in the cache budget.
+	for _, tt := range []struct {
+		budget int64
+		masks  int
+	}{{budget: 0, masks: 1}, {budget: 4, masks: 0}} {
+		var placed int
+		update := func(image.Image) { placed++ }
+		c := newCanvas(image.Rect(0, 0, 8, 4), Config{}, imglib.NewCache(tt.budget), update)
+
+		err := composeMatches(context.Background(), c, matches, logf)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, placed)
+		assert.Len(t, c.masks, tt.masks)
+	}
+}
+
+func TestTileTint(t *testing.T) {
+	t.Parallel()
+
+	want := color.NRGBA{191, 0, 63, 255}
+	img := uniform(image.Rect(0, 0, 8, 8), want)
+	tile := uniform(image.Rect(0, 0, 4, 4), color.White)
+	cfg := Config{Tint: true, Logf: func(string, ...interface{}) {}}
+	// Color permutations are ignored.
+	cfg.TilesPermute.NumR = 4
+
+	out, err := TileContext(context.Background(), img, []image.Image{tile}, cfg, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, color.RGBAModel.Convert(want), out.At(1, 1))
+
+	// Blend modes that recolor the tiles can't be used with tint.
+	for _, mode := range []BlendMode{BlendColor, BlendLuminance} {
+		cfg.Blend = Blend{Mode: mode, Opacity: 0.5}
+		_, err = TileContext(context.Background(), img, []image.Image{tile}, cfg, nil)
+		assert.Error(t, err, mode)
+	}
+	cfg.Blend = Blend{Mode: BlendOverlay, Opacity: 0.5}
+	_, err = TileContext(context.Background(), img, []image.Image{tile}, cfg, nil)
+	assert.NoError(t, err)
+}
+
+func TestTileOrient(t *testing.T) {
+	t.Parallel()
+
+	// An image of vertical stripes.
+	img := uniform(image.Rect(0, 0, 16, 16), color.Black)
+	for x := 0; x < 16; x += 4 {
+		draw.Draw(img, image.Rect(x, 0, x+2, 16), image.NewUniform(color.White), image.ZP, draw.Src)
+	}
+	// A horizontal white bar.
+	tile := image.NewRGBA(image.Rect(0, 0, 8, 4))
+	draw.Draw(tile, image.Rect(0, 1, 8, 3), image.NewUniform(color.White), image.ZP, draw.Src)
+
+	cfg := Config{Overlap: true, Logf: func(string, ...interface{}) {}}
+	cfg.TilesPermute.Filter = FilterNearest
+
+	out, err := TileContext(context.Background(), img, []image.Image{tile}, cfg, nil)
+	assert.NoError(t, err)
+	white, transparent := color.RGBA{255, 255, 255, 255}, color.RGBA{}
+	assert.Equal(t, white, out.At(0, 1))
+	assert.Equal(t, transparent, out.At(3, 0))
+
+	// Tiles follow the stripes.
+	cfg.Orient = true
+	out, err = TileContext(context.Background(), img, []image.Image{tile}, cfg, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, transparent, out.At(0, 1))
+	assert.Equal(t, white, out.At(3, 0))
+}
+
+func TestTileReleasesCache(t *testing.T) {
+	t.Parallel()
+
+	img := uniform(image.Rect(0, 0, 16, 16), color.White)
+	draw.Draw(img, image.Rect(0, 0, 8, 16), image.NewUniform(color.Black), image.ZP, draw.Src)
+	tiles := []image.Image{uniform(image.Rect(0, 0, 4, 4), color.White), uniform(image.Rect(0, 0, 4, 4), color.Black)}
+	cfg := Config{Logf: func(string, ...interface{}) {}}
+	cfg.TilesPermute.MemoryBudget = 1 << 20
+
+	tl, err := newTiling(context.Background(), img, tiles, cfg)
+	if !assert.NoError(t, err) {
+		return
+	}
+	// The reserved bytes of the signatures don't grow with the number of tiled images.
+	reserved := tl.cache.Reserved()
+	for i := 0; i < 5; i++ {
+		_, _, err := tl.tile(context.Background(), img, nil, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, reserved, tl.cache.Reserved())
+	}
+}